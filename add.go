@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseAddArgs parses the arguments of `gom add`: the package name, options
+// written as in a Gomfile and any number of --group flags.
+func parseAddArgs(args []string) (Gom, []string, error) {
+	name := ""
+	groups := []string{}
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-group" || arg == "--group":
+			i++
+			if i == len(args) {
+				return Gom{}, nil, errors.New("--group needs a group name")
+			}
+			groups = append(groups, splitGroups(args[i])...)
+		case strings.HasPrefix(arg, "-group=") || strings.HasPrefix(arg, "--group="):
+			groups = append(groups, splitGroups(arg[strings.Index(arg, "=")+1:])...)
+		case name == "":
+			name = arg
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if name == "" {
+		return Gom{}, nil, errors.New("no package given")
+	}
+
+	prefix := "gom " + quoteGomfileString(name)
+	options := strings.TrimSpace(strings.Join(rest, " "))
+	if options != "" && !strings.HasPrefix(options, ",") {
+		prefix += ", "
+	}
+	file, err := parseGomfileSource("options", []byte(prefix+options))
+	if err != nil {
+		if se, ok := err.(*SyntaxError); ok && se.Pos.Line == 1 {
+			se.Pos.Col -= len(prefix)
+		}
+		return Gom{}, nil, err
+	}
+	decl := file.Stmts[0].(*GomDecl)
+	return Gom{name, decl.options()}, groups, nil
+}
+
+func splitGroups(s string) []string {
+	groups := []string{}
+	for _, group := range strings.Split(s, ",") {
+		group = strings.TrimPrefix(strings.TrimSpace(group), ":")
+		if group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// addGom declares a new package in the Gomfile, installs it into the vendor
+// directory and refreshes Gomfile.lock.
+func addGom(args []string) error {
+	gom, groups, err := parseAddArgs(args)
+	if err != nil {
+		return err
+	}
+	doc, err := readDocument("Gomfile")
+	if err != nil {
+		return err
+	}
+	err = doc.Add(gom, groups)
+	if err != nil {
+		return err
+	}
+
+	err = prepareVendor()
+	if err != nil {
+		return err
+	}
+	err = ready()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("adding %s\n", gom.name)
+	r := directRunner()
+	err = gom.Clone(r)
+	if err != nil {
+		return err
+	}
+	err = gom.Checkout(r)
+	if err != nil {
+		return err
+	}
+	err = fetchImports([]Gom{gom})
+	if err != nil {
+		return err
+	}
+	err = gom.Build(r, []string{})
+	if err != nil {
+		return err
+	}
+
+	err = doc.Save()
+	if err != nil {
+		return err
+	}
+	return refreshGomfileLock()
+}
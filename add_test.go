@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddArgs(t *testing.T) {
+	gom, groups, err := parseAddArgs([]string{"--group", "test", "github.com/mattn/go-sqlite3", ":tag", "=>", "'v1.0'", "-group=:custom,other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "v1.0"}}
+	if !reflect.DeepEqual(gom, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, gom)
+	}
+	if !reflect.DeepEqual(groups, []string{"test", "custom", "other"}) {
+		t.Fatalf("Expected %v, but %v:", []string{"test", "custom", "other"}, groups)
+	}
+
+	_, _, err = parseAddArgs([]string{"github.com/mattn/go-sqlite3", ":tag", "'v1.0"})
+	if err == nil || err.Error() != "options:1:6: syntax error: unterminated string" {
+		t.Fatalf("Expected a syntax error, but %v:", err)
+	}
+}
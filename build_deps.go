@@ -1,7 +1,7 @@
 package main
 
 import (
-	"os"
+	"go/build"
 	"path/filepath"
 )
 
@@ -10,49 +10,124 @@ func buildDeps(args []string) error {
 	if err != nil {
 		return err
 	}
-	vendor, err := filepath.Abs(vendorFolder)
+	err = prepareVendor()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(vendor)
-	if err != nil {
-		err = os.MkdirAll(vendor, 0755)
-		if err != nil {
-			return err
-		}
-	}
-	err = os.Setenv("GOPATH", vendor)
-	if err != nil {
-		return err
-	}
-	err = os.Setenv("GOBIN", filepath.Join(vendor, "bin"))
+
+	// 1. Filter goms to build
+	goms := installableGoms(allGoms)
+
+	// 2. Build and install
+	return buildGoms(goms, args)
+}
+
+// buildGoms builds the goms in parallel, each one after the goms it imports.
+func buildGoms(goms []Gom, args []string) error {
+	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
 	}
+	deps := gomDependencies(vendor, goms)
+	return forEachGomInOrder(goms, deps, func(r *runner, gom *Gom) error {
+		return gom.Build(r, args)
+	})
+}
 
-	// 1. Filter goms to build
-	goms := make([]Gom, 0)
-	for _, gom := range allGoms {
-		if group, ok := gom.options["group"]; ok {
-			if !matchEnv(group) {
-				continue
+// gomDependencies returns, for every gom, the indexes of the goms it imports
+// either directly or through other packages of the vendor directory.
+func gomDependencies(vendor string, goms []Gom) [][]int {
+	ctxt := build.Default
+	ctxt.GOPATH = vendor
+
+	index := make(map[string]int)
+	for i, gom := range goms {
+		index[gom.name] = i
+	}
+	imports := make(map[string][]string)
+	directImports := func(path string) []string {
+		if imps, ok := imports[path]; ok {
+			return imps
+		}
+		imps := []string{}
+		// Packages which can't be loaded, like repository roots without Go
+		// files, simply have no dependencies.
+		if pkg, err := ctxt.Import(path, "", build.AllowBinary); err == nil {
+			for _, imp := range pkg.Imports {
+				if !isStandardImport(imp) {
+					imps = append(imps, imp)
+				}
 			}
 		}
-		if goos, ok := gom.options["goos"]; ok {
-			if !matchOS(goos) {
-				continue
+		imports[path] = imps
+		return imps
+	}
+
+	deps := make([][]int, len(goms))
+	for i, gom := range goms {
+		seen := map[string]bool{gom.name: true}
+		queue := []string{gom.name}
+		for len(queue) > 0 {
+			path := queue[0]
+			queue = queue[1:]
+			for _, imp := range directImports(path) {
+				if seen[imp] {
+					continue
+				}
+				seen[imp] = true
+				if j, ok := index[imp]; ok && j != i {
+					deps[i] = append(deps[i], j)
+				}
+				queue = append(queue, imp)
 			}
 		}
-		goms = append(goms, gom)
 	}
+	return deps
+}
+
+// missingImports returns the packages goms import, either directly or through
+// other packages of the vendor directory, that are neither in the standard
+// library nor in the vendor directory.
+func missingImports(vendor string, goms []Gom) []string {
+	ctxt := build.Default
+	ctxt.GOPATH = vendor
 
-	// 4. Build and install
+	missing := []string{}
+	seen := make(map[string]bool)
+	queue := []string{}
 	for _, gom := range goms {
-		err = gom.Build(args)
+		seen[gom.name] = true
+		queue = append(queue, gom.name)
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		pkg, err := ctxt.Import(path, "", build.AllowBinary)
 		if err != nil {
-			return err
+			continue
+		}
+		for _, imp := range pkg.Imports {
+			if seen[imp] || isStandardImport(imp) {
+				continue
+			}
+			seen[imp] = true
+			if isDir(filepath.Join(vendor, "src", filepath.FromSlash(imp))) {
+				queue = append(queue, imp)
+			} else if !isVendored(filepath.Join(vendor, "src"), pkg.Dir, imp) {
+				missing = append(missing, imp)
+			}
 		}
 	}
+	return missing
+}
 
-	return nil
+// isVendored tells whether imp is in a vendor directory of dir or of one of
+// its parents under src.
+func isVendored(src, dir, imp string) bool {
+	for ; len(dir) > len(src); dir = filepath.Dir(dir) {
+		if isDir(filepath.Join(dir, "vendor", filepath.FromSlash(imp))) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGomDependencies(t *testing.T) {
+	vendor, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendor)
+
+	// a imports b directly and d through c, which isn't in the Gomfile.
+	sources := map[string]string{
+		"example.com/a":     `package a; import (_ "example.com/b"; _ "example.com/c"; _ "fmt")`,
+		"example.com/b":     `package b`,
+		"example.com/c":     `package c; import _ "example.com/d/sub"`,
+		"example.com/d/sub": `package sub; import _ "example.com/d"`,
+		"example.com/d":     `package d`,
+	}
+	for path, src := range sources {
+		dir := filepath.Join(vendor, "src", path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goms := []Gom{{name: "example.com/a"}, {name: "example.com/b"}, {name: "example.com/d"}, {name: "example.com/missing"}}
+	deps := gomDependencies(vendor, goms)
+	expected := [][]int{{1, 2}, nil, nil, nil}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, deps)
+	}
+}
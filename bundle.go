@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// bundleManifestName is the entry of a bundle describing its packages. It
+// comes first in the archive, before the sources under src/.
+const bundleManifestName = "gom-bundle.json"
+
+type bundleManifest struct {
+	Packages []bundlePackage `json:"packages"`
+}
+
+// bundlePackage is a package of a bundle, with the repository it was
+// checked out from.
+type bundlePackage struct {
+	Name     string `json:"name"`
+	Root     string `json:"root"`
+	VCS      string `json:"vcs"`
+	URL      string `json:"url,omitempty"`
+	Commit   string `json:"commit"`
+	Checksum string `json:"checksum"`
+}
+
+// bundleCommand implements `gom bundle pack`.
+func bundleCommand(args []string) error {
+	if len(args) == 0 || args[0] != "pack" {
+		return errors.New("usage: gom bundle pack [-o bundle.tgz]")
+	}
+	fs := flag.NewFlagSet("bundle pack", flag.ContinueOnError)
+	output := fs.String("o", "bundle.tgz", "archive to write")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return packBundle(*output)
+}
+
+// packBundle writes the sources of the packages selected by the Gomfile, as
+// locked by Gomfile.lock and without VCS metadata, in a tar.gz archive.
+func packBundle(output string) error {
+	if !isFile("Gomfile.lock") {
+		return errors.New("Gomfile.lock is needed to pack a bundle. Run `gom lock` first")
+	}
+	allGoms, err := parseGomfile("Gomfile")
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	var manifest bundleManifest
+	roots := []string{}
+	for _, gom := range installableGoms(allGoms) {
+		report := checkReport(vendor, gom)
+		if report.Status != statusOK {
+			return fmt.Errorf("%s is %s. Run `gom install` and `gom lock` first", gom.name, report.Status)
+		}
+		vcs, dir, err := getVcsCommand(vendor, filepath.Join(vendor, "src", gom.name))
+		if err != nil {
+			return err
+		}
+		root, err := filepath.Rel(filepath.Join(vendor, "src"), dir)
+		if err != nil {
+			return err
+		}
+		url, _ := vcs.RemoteURL(dir)
+		sum, err := checksumDir(filepath.Join(vendor, "src", gom.name))
+		if err != nil {
+			return err
+		}
+		manifest.Packages = append(manifest.Packages, bundlePackage{
+			Name:     gom.name,
+			Root:     filepath.ToSlash(root),
+			VCS:      vcs.Name(),
+			URL:      url,
+			Commit:   report.Installed,
+			Checksum: sum,
+		})
+		if !has(roots, filepath.ToSlash(root)) {
+			roots = append(roots, filepath.ToSlash(root))
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{Name: bundleManifestName, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+	for _, root := range roots {
+		err = addBundleDir(tw, filepath.Join(vendor, "src"), filepath.FromSlash(root))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%d packages are packed in %s\n", len(manifest.Packages), output)
+	return f.Close()
+}
+
+// addBundleDir adds the files of src/root to the archive, except VCS
+// metadata.
+func addBundleDir(tw *tar.Writer, src, root string) error {
+	return filepath.Walk(filepath.Join(src, root), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if has(vcsMetadata, fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join("src", filepath.ToSlash(rel))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+// installBundle replaces the sources of goms in the vendor directory with
+// the ones of the bundle, after checking that the bundle has the revisions
+// Gomfile.lock pins and that their checksums match.
+func installBundle(filename string, goms []Gom) error {
+	if !isFile("Gomfile.lock") {
+		return errors.New("Gomfile.lock is needed to install from a bundle")
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != bundleManifestName {
+		return fmt.Errorf("%s is not a gom bundle", filename)
+	}
+	var manifest bundleManifest
+	err = json.NewDecoder(tr).Decode(&manifest)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	packages := make(map[string]bundlePackage)
+	for _, p := range manifest.Packages {
+		packages[p.Name] = p
+	}
+	roots := []string{}
+	for _, gom := range goms {
+		p, ok := packages[gom.name]
+		if !ok {
+			return fmt.Errorf("%s is not in %s", gom.name, filename)
+		}
+		if commit, ok := gom.options["commit"].(string); ok && commit != p.Commit {
+			return fmt.Errorf("%s is at %s in %s but Gomfile.lock pins %s", gom.name, p.Commit, filename, commit)
+		}
+		if !has(roots, p.Root) {
+			roots = append(roots, p.Root)
+		}
+	}
+
+	// The sources are extracted and verified aside, so that a bad bundle
+	// leaves the installed ones as they were.
+	staging, err := ioutil.TempDir(vendor, ".gom-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = extractBundleEntry(tr, hdr, staging, roots)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, gom := range goms {
+		p := packages[gom.name]
+		sum, err := checksumDir(filepath.Join(staging, "src", gom.name))
+		if err != nil {
+			return err
+		}
+		expected, ok := gom.options["checksum"].(string)
+		if !ok {
+			expected = p.Checksum
+		}
+		if sum != expected {
+			return fmt.Errorf("%s: checksum mismatch. Expected %s, got %s", gom.name, expected, sum)
+		}
+	}
+
+	src := filepath.Join(vendor, "src")
+	for _, root := range roots {
+		dest := filepath.Join(src, filepath.FromSlash(root))
+		err = os.RemoveAll(dest)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(filepath.Join(staging, "src", filepath.FromSlash(root)), dest)
+		if err != nil {
+			return err
+		}
+	}
+	for _, gom := range goms {
+		fmt.Printf("installing %s at %s from %s\n", gom.name, shortRevision(packages[gom.name].Commit), filename)
+	}
+	return nil
+}
+
+// extractBundleEntry writes an entry of a bundle under dir if it belongs to
+// one of the repositories to install.
+func extractBundleEntry(tr *tar.Reader, hdr *tar.Header, dir string, roots []string) error {
+	name := path.Clean(hdr.Name)
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid path %s in the bundle", hdr.Name)
+	}
+	wanted := false
+	for _, root := range roots {
+		wanted = wanted || strings.HasPrefix(name+"/", path.Join("src", root)+"/")
+	}
+	if !wanted {
+		return nil
+	}
+
+	dest := filepath.Join(dir, filepath.FromSlash(name))
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(dest, 0755)
+	case tar.TypeSymlink:
+		target := path.Join(path.Dir(name), hdr.Linkname)
+		if path.IsAbs(hdr.Linkname) || !strings.HasPrefix(target, "src/") {
+			return fmt.Errorf("invalid link %s in the bundle", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, dest)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dest, b, os.FileMode(hdr.Mode).Perm())
+	}
+	return nil
+}
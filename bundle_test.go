@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	a := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	gitRepo(t, a)
+	if err := os.MkdirAll(filepath.Join(a, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(a, "sub", "y.go"), []byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, a, "add", ".")
+	gitCmd(t, a, "commit", "-q", "-m", "sub")
+	rev := gitCmd(t, a, "rev-parse", "HEAD")
+	sum, err := checksumDir(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("Gomfile", []byte("gom 'example.com/a'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock := "gom 'example.com/a', :commit => '" + rev + "', :checksum => '" + sum + "'\n"
+	if err := ioutil.WriteFile("Gomfile.lock", []byte(lock), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := packBundle("bundle.tgz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(a); err != nil {
+		t.Fatal(err)
+	}
+
+	goms, err := parseGomfile("Gomfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := installBundle("bundle.tgz", goms); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(a, "sub", "y.go")) {
+		t.Fatal("Expected the sources to be installed")
+	}
+	if isDir(filepath.Join(a, ".git")) {
+		t.Fatal("Expected the bundle to have no VCS metadata")
+	}
+	if report := checkReport(filepath.Join(dir, vendorFolder), goms[0]); report.Status != statusOK {
+		t.Fatalf("Expected %v, but %v:", statusOK, report.Status)
+	}
+
+	// A bundle failing the checksum leaves the installed sources alone.
+	goms[0].options["checksum"] = "sha256:0000"
+	err = installBundle("bundle.tgz", goms)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch, but %v:", err)
+	}
+	if !isFile(filepath.Join(a, "sub", "y.go")) {
+		t.Fatal("Expected the installed sources to be kept")
+	}
+	if staged, _ := filepath.Glob(filepath.Join(dir, vendorFolder, ".gom-bundle*")); len(staged) > 0 {
+		t.Fatalf("Expected the extracted sources to be removed, but %v:", staged)
+	}
+	goms[0].options["checksum"] = sum
+
+	goms[0].options["commit"] = "0123456789"
+	err = installBundle("bundle.tgz", goms)
+	if err == nil || !strings.Contains(err.Error(), "Gomfile.lock pins 0123456789") {
+		t.Fatalf("Expected a revision mismatch, but %v:", err)
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// offline makes `gom install` use the cache only, without going to the
+// network.
+var offline bool
+
+// cacheDir returns the directory of the mirrors shared by all projects,
+// $GOM_CACHE or gom in the user cache directory, or "" if GOM_CACHE is off.
+func cacheDir() (string, error) {
+	dir := os.Getenv("GOM_CACHE")
+	if dir == "off" {
+		return "", nil
+	}
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(userCache, "gom")
+	}
+	return filepath.Abs(dir)
+}
+
+// cacheSource finds the VCS, repository root and remote URL of gom: from its
+// :url, its installed copy, a mirror of the cache or with resolveRepo. The
+// VCS is nil if none of them knows it or if it can't be mirrored.
+func (gom *Gom) cacheSource(vendor, cache string) (mirrorer, string, string) {
+	if has(gom.options, "url") {
+		repo, err := gom.repo()
+		if err != nil {
+			return nil, "", ""
+		}
+		vcs := mirrorerOf(repo.vcs)
+		if vcs == nil {
+			return nil, "", ""
+		}
+		mirror := filepath.Join(cache, filepath.FromSlash(repo.root))
+		if m := mirrorAt(mirror); m != nil {
+			if url, _ := m.RemoteURL(mirror); url != repo.url {
+				// The cache mirrors another repository at this path, such
+				// as the upstream of a fork: fetch directly.
+				return nil, "", ""
+			}
+		}
+		return vcs, repo.root, repo.url
+	}
+
+	src := filepath.Join(vendor, "src")
+	if found, dir, err := getVcsCommand(vendor, filepath.Join(src, gom.name)); err == nil {
+		vcs := mirrorerOf(found)
+		if vcs == nil {
+			// svn and fossil checkouts aren't mirrored.
+			return nil, "", ""
+		}
+		root, err := filepath.Rel(src, dir)
+		url, _ := vcs.RemoteURL(dir)
+		if err == nil && url != "" {
+			return vcs, filepath.ToSlash(root), url
+		}
+	}
+
+	elems := strings.Split(gom.name, "/")
+	for i := 1; i <= len(elems); i++ {
+		root := strings.Join(elems[:i], "/")
+		mirror := filepath.Join(cache, filepath.FromSlash(root))
+		if vcs := mirrorAt(mirror); vcs != nil {
+			url, _ := vcs.RemoteURL(mirror)
+			return vcs, root, url
+		}
+	}
+
+	repo, err := gom.repo()
+	if err != nil {
+		return nil, "", ""
+	}
+	if vcs := mirrorerOf(repo.vcs); vcs != nil {
+		return vcs, repo.root, repo.url
+	}
+	return nil, "", ""
+}
+
+// updateMirror makes sure the cache has a mirror of the repository of gom
+// with its pinned revision, creating or updating it unless offline. The VCS
+// is nil when the source of gom is unknown.
+func (gom *Gom) updateMirror(r *runner, vendor, cache string) (vcs mirrorer, root, url string, err error) {
+	vcs, root, url = gom.cacheSource(vendor, cache)
+	if vcs == nil {
+		return nil, "", "", nil
+	}
+	mirror := filepath.Join(cache, filepath.FromSlash(root))
+	dest := filepath.Join(vendor, "src", filepath.FromSlash(root))
+	commit, _ := gom.options["commit"].(string)
+
+	fetched := false
+	if mirrorAt(mirror) == nil {
+		if offline {
+			return nil, "", "", fmt.Errorf("%s is not in the cache %s", gom.name, cache)
+		}
+		r.printf("caching %s\n", root)
+		if isDir(dest) && !isShallow(vcs, dest) {
+			// Mirror the installed copy rather than download it again.
+			err = vcs.Mirror(r, dest, mirror)
+			if err == nil {
+				err = vcs.SetRemote(mirror, url)
+			}
+		} else {
+			err = vcs.Mirror(r, url, mirror)
+			fetched = true
+		}
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+	if !offline && !fetched && (commit == "" || !vcs.Contains(mirror, commit)) {
+		r.printf("updating the cache of %s\n", root)
+		err = vcs.Fetch(r, mirror)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+	if commit != "" && !vcs.Contains(mirror, commit) {
+		return nil, "", "", fmt.Errorf("revision %s of %s is not in the cache %s", commit, gom.name, cache)
+	}
+	return vcs, root, url, nil
+}
+
+// noCacheWarning warns only once that there is no cache directory.
+var noCacheWarning sync.Once
+
+// cloneFromCache installs gom from its mirror in the cache, creating or
+// updating the mirror first unless offline. It returns false without error
+// when the cache is off or can't hold the repository of gom, and when there
+// is no cache directory unless offline.
+func (gom *Gom) cloneFromCache(r *runner, vendor string) (bool, error) {
+	cache, err := cacheDir()
+	if err != nil {
+		if offline {
+			return false, err
+		}
+		noCacheWarning.Do(func() {
+			r.printf("Warning: no cache, fetching directly: %v\n", err)
+		})
+		return false, nil
+	}
+	if cache == "" {
+		return false, nil
+	}
+	commit, _ := gom.options["commit"].(string)
+	if offline && commit != "" {
+		vcs, root, _ := gom.cacheSource(vendor, cache)
+		dest := filepath.Join(vendor, "src", filepath.FromSlash(root))
+		if vcs != nil && isDir(dest) && vcs.Contains(dest, commit) {
+			return true, nil
+		}
+	}
+
+	if !offline && gom.shallowRevision() != "" {
+		// Mirroring the whole history to check out a single revision
+		// would defeat the shallow clone, so the cache is only used when
+		// it has the repository already.
+		vcs, root, _ := gom.cacheSource(vendor, cache)
+		mirror := filepath.Join(cache, filepath.FromSlash(root))
+		dest := filepath.Join(vendor, "src", filepath.FromSlash(root))
+		if _, ok := vcs.(shallowFetcher); ok && mirrorAt(mirror) == nil {
+			if !isDir(dest) || isShallow(vcs, dest) {
+				return false, nil
+			}
+		}
+	}
+
+	vcs, root, url, err := gom.updateMirror(r, vendor, cache)
+	if vcs == nil || err != nil {
+		return false, err
+	}
+	mirror := filepath.Join(cache, filepath.FromSlash(root))
+	dest := filepath.Join(vendor, "src", filepath.FromSlash(root))
+	if !isDir(dest) {
+		r.printf("installing %s from the cache\n", root)
+		err = vcs.Clone(r, mirror, dest)
+		if err != nil {
+			return false, err
+		}
+		if url == "" {
+			return true, nil
+		}
+		return true, vcs.SetRemote(dest, url)
+	}
+	if commit == "" || !vcs.Contains(dest, commit) {
+		return true, vcs.PullFrom(r, dest, mirror)
+	}
+	return true, nil
+}
+
+// lockfilesName is the file of the cache listing the Gomfile.lock files of
+// the projects using it, so that prune knows what is still needed.
+const lockfilesName = "lockfiles"
+
+// knownLockfiles returns the Gomfile.lock files recorded in the cache.
+func knownLockfiles(cache string) []string {
+	b, err := ioutil.ReadFile(filepath.Join(cache, lockfilesName))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(b))
+}
+
+func writeLockfiles(cache string, lockfiles []string) error {
+	err := os.MkdirAll(cache, 0755)
+	if err != nil {
+		return err
+	}
+	content := strings.Join(lockfiles, "\n") + "\n"
+	return ioutil.WriteFile(filepath.Join(cache, lockfilesName), []byte(content), 0644)
+}
+
+// rememberLockfile records filename among the Gomfile.lock files using the
+// cache. Failing to do so only matters to prune, so it isn't an error.
+func rememberLockfile(filename string) {
+	cache, err := cacheDir()
+	if err != nil || cache == "" {
+		return
+	}
+	filename, err = filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	lockfiles := knownLockfiles(cache)
+	if has(lockfiles, filename) {
+		return
+	}
+	writeLockfiles(cache, append(lockfiles, filename))
+}
+
+// cacheMirrors returns the repository roots of the mirrors in the cache.
+func cacheMirrors(cache string) ([]string, error) {
+	roots := []string{}
+	err := filepath.Walk(cache, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == cache {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.IsDir() || mirrorAt(path) == nil {
+			return nil
+		}
+		root, err := filepath.Rel(cache, path)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, filepath.ToSlash(root))
+		return filepath.SkipDir
+	})
+	return roots, err
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	s, i := float64(size), 0
+	for s >= 1024 && i < len(units)-1 {
+		s /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", s, units[i])
+}
+
+// cacheCommand implements `gom cache list|prune|fill|verify`.
+func cacheCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: gom cache list|prune|fill|verify")
+	}
+	cache, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	if cache == "" {
+		return errors.New("the cache is off, unset GOM_CACHE to use it")
+	}
+	switch args[0] {
+	case "list", "ls":
+		return cacheList(cache)
+	case "prune":
+		return cachePrune(cache, args[1:])
+	case "fill":
+		return cacheFill(cache, args[1:])
+	case "verify":
+		return cacheVerify(cache)
+	}
+	return fmt.Errorf("unknown cache command %q, expected list, prune, fill or verify", args[0])
+}
+
+// cacheList prints the mirrors of the cache with their size.
+func cacheList(cache string) error {
+	roots, err := cacheMirrors(cache)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tVCS\tSIZE\tURL")
+	var total int64
+	for _, root := range roots {
+		mirror := filepath.Join(cache, filepath.FromSlash(root))
+		vcs := mirrorAt(mirror)
+		url, _ := vcs.RemoteURL(mirror)
+		size := dirSize(mirror)
+		total += size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", root, vcs.Name(), formatSize(size), url)
+	}
+	w.Flush()
+	fmt.Fprintf(stdout, "%d repositories, %s in %s\n", len(roots), formatSize(total), cache)
+	return nil
+}
+
+// cachePrune removes the mirrors no known Gomfile.lock refers to. The
+// Gomfile.lock files given in args are remembered first, and the ones which
+// don't exist anymore forgotten.
+func cachePrune(cache string, args []string) error {
+	dryRun := false
+	lockfiles := []string{}
+	for _, lockfile := range knownLockfiles(cache) {
+		if isFile(lockfile) {
+			lockfiles = append(lockfiles, lockfile)
+		}
+	}
+	for _, arg := range args {
+		if arg == "-n" || arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		lockfile, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		if !isFile(lockfile) {
+			return fmt.Errorf("%s doesn't exist", arg)
+		}
+		if !has(lockfiles, lockfile) {
+			lockfiles = append(lockfiles, lockfile)
+		}
+	}
+	if len(lockfiles) == 0 {
+		return errors.New("no Gomfile.lock is known to use the cache, give the ones to keep")
+	}
+
+	used := []string{}
+	for _, lockfile := range lockfiles {
+		goms, err := readAllGoms(lockfile)
+		if err != nil {
+			return err
+		}
+		for _, gom := range goms {
+			used = append(used, gom.name)
+		}
+	}
+	roots, err := cacheMirrors(cache)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	for _, root := range roots {
+		needed := false
+		for _, name := range used {
+			needed = needed || name == root || strings.HasPrefix(name, root+"/")
+		}
+		if needed {
+			continue
+		}
+		mirror := filepath.Join(cache, filepath.FromSlash(root))
+		size := dirSize(mirror)
+		freed += size
+		fmt.Fprintf(stdout, "removing %s (%s)\n", root, formatSize(size))
+		if dryRun {
+			continue
+		}
+		err = os.RemoveAll(mirror)
+		if err != nil {
+			return err
+		}
+		// Remove the directories of the host and owner left empty.
+		for dir := filepath.Dir(mirror); dir != cache; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	fmt.Fprintf(stdout, "%s freed\n", formatSize(freed))
+	if dryRun {
+		return nil
+	}
+	return writeLockfiles(cache, lockfiles)
+}
+
+// cacheFill mirrors every package a Gomfile needs, in all its groups and
+// for all OSes, so that `gom install --offline` works without network.
+func cacheFill(cache string, args []string) error {
+	gomfile := "Gomfile"
+	if len(args) > 0 {
+		gomfile = args[0]
+	}
+	filename := gomfile
+	if isFile(gomfile + ".lock") {
+		filename = gomfile + ".lock"
+		rememberLockfile(filename)
+	}
+	goms, err := readAllGoms(filename)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(filepath.Join(filepath.Dir(gomfile), vendorFolder))
+	if err != nil {
+		return err
+	}
+
+	fill := []Gom{}
+	for _, gom := range goms {
+		if gom.fetchedItself() {
+			fmt.Fprintf(stdout, "Warning: %s is fetched by its own command and isn't cached\n", gom.name)
+			continue
+		}
+		fill = append(fill, gom)
+	}
+	return forEachGom(fill, func(r *runner, gom *Gom) error {
+		defer lockRepository(gom)()
+		vcs, _, _, err := gom.updateMirror(r, vendor, cache)
+		if err == nil && vcs == nil {
+			err = fmt.Errorf("don't know where to fetch %s from, install it once to cache it", gom.name)
+		}
+		return err
+	})
+}
+
+// cacheVerify checks the integrity of every mirror of the cache.
+func cacheVerify(cache string) error {
+	roots, err := cacheMirrors(cache)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, root := range roots {
+		mirror := filepath.Join(cache, filepath.FromSlash(root))
+		err := mirrorAt(mirror).Verify(mirror)
+		if err != nil {
+			failed++
+			fmt.Fprintf(stdout, "%s: %v\n", root, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", root)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d mirrors are corrupt, remove them and run gom cache fill", failed, len(roots))
+	}
+	return nil
+}
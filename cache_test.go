@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain keeps the tests away from the cache of the user.
+func TestMain(m *testing.M) {
+	cache, err := ioutil.TempDir("", "gom-cache")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("GOM_CACHE", cache)
+	code := m.Run()
+	os.RemoveAll(cache)
+	os.Exit(code)
+}
+
+func TestCloneFromCache(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache := os.Getenv("GOM_CACHE")
+	defer os.Setenv("GOM_CACHE", oldcache)
+	cache := filepath.Join(dir, "cache")
+	os.Setenv("GOM_CACHE", cache)
+	defer func() {
+		offline = false
+	}()
+
+	origin := filepath.Join(dir, "origin")
+	rev1 := gitRepo(t, origin)
+	r := directRunner()
+	if err := git.Mirror(r, origin, filepath.Join(cache, "example.com", "a")); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	rev2 := gitCmd(t, origin, "rev-parse", "HEAD")
+
+	vendor := filepath.Join(dir, "vendor")
+	dest := filepath.Join(vendor, "src", "example.com", "a")
+	offline = true
+	gom := &Gom{name: "example.com/a/sub", options: map[string]interface{}{"commit": rev1}}
+	cached, err := gom.cloneFromCache(r, vendor)
+	if err != nil || !cached {
+		t.Fatalf("Expected to install from the cache, but %v, %v:", cached, err)
+	}
+	if !git.Contains(dest, rev1) {
+		t.Fatalf("Expected %s to contain %s", dest, rev1)
+	}
+	if url, _ := git.RemoteURL(dest); url != origin {
+		t.Fatalf("Expected %v, but %v:", origin, url)
+	}
+
+	gom.options["commit"] = rev2
+	_, err = gom.cloneFromCache(r, vendor)
+	if err == nil || !strings.Contains(err.Error(), "is not in the cache") {
+		t.Fatalf("Expected %s not to be in the cache, but %v:", rev2, err)
+	}
+
+	offline = false
+	if _, err := gom.cloneFromCache(r, vendor); err != nil {
+		t.Fatal(err)
+	}
+	if !git.Contains(dest, rev2) {
+		t.Fatalf("Expected %s to contain %s", dest, rev2)
+	}
+
+	offline = true
+	err = (&Gom{name: "example.com/b", options: map[string]interface{}{}}).Clone(r)
+	if err == nil || err.Error() != "example.com/b is not in the cache" {
+		t.Fatalf("Expected example.com/b not to be in the cache, but %v:", err)
+	}
+}
+
+func TestCloneWithoutCacheDir(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	origin := filepath.Join(dir, "origin")
+	rev := gitRepo(t, origin)
+
+	oldcache, oldhome, oldxdg := os.Getenv("GOM_CACHE"), os.Getenv("HOME"), os.Getenv("XDG_CACHE_HOME")
+	defer func() {
+		os.Setenv("GOM_CACHE", oldcache)
+		os.Setenv("HOME", oldhome)
+		os.Setenv("XDG_CACHE_HOME", oldxdg)
+		offline = false
+	}()
+	os.Setenv("GOM_CACHE", "")
+	os.Setenv("HOME", "")
+	os.Setenv("XDG_CACHE_HOME", "")
+
+	gom := Gom{name: "example.com/a", options: map[string]interface{}{"url": origin, "commit": rev}}
+	offline = true
+	if err := gom.Clone(directRunner()); err == nil {
+		t.Fatalf("Expected an error without a cache directory offline, but %v:", err)
+	}
+	offline = false
+	if err := gom.Clone(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if installed := installedRevision(filepath.Join(dir, vendorFolder), gom.name); installed != rev {
+		t.Fatalf("Expected %v, but %v:", rev, installed)
+	}
+}
+
+func TestCacheSource(t *testing.T) {
+	vcs, root, url := (&Gom{name: "github.com/heetch/gom/sub"}).cacheSource("/nonexistent", "/nonexistent")
+	if vcs != git || root != "github.com/heetch/gom" || url != "https://github.com/heetch/gom" {
+		t.Fatalf("Expected git github.com/heetch/gom, but %v %v %v:", vcs, root, url)
+	}
+	offline = true
+	defer func() {
+		offline = false
+	}()
+	if vcs, _, _ := (&Gom{name: "example.com/a"}).cacheSource("/nonexistent", "/nonexistent"); vcs != nil {
+		t.Fatalf("Expected no source for example.com/a, but %v:", vcs.Name())
+	}
+}
+
+func TestCacheCommand(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache, oldstdout := os.Getenv("GOM_CACHE"), stdout
+	defer func() {
+		os.Setenv("GOM_CACHE", oldcache)
+		stdout = oldstdout
+	}()
+	cache := filepath.Join(dir, "cache")
+	os.Setenv("GOM_CACHE", cache)
+
+	origin := filepath.Join(dir, "origin")
+	gitRepo(t, origin)
+	r := directRunner()
+	for _, name := range []string{"a", "unused"} {
+		if err := git.Mirror(r, origin, filepath.Join(cache, "example.com", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	rev := gitCmd(t, origin, "rev-parse", "HEAD")
+	err := ioutil.WriteFile("Gomfile.lock", []byte("gom 'example.com/a/sub', :commit => '"+rev+"'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := func(args ...string) string {
+		f, err := ioutil.TempFile("", "gom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		stdout = f
+		err = cacheCommand(args)
+		stdout = oldstdout
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	out := output("list")
+	if !strings.Contains(out, "example.com/a ") || !strings.Contains(out, "example.com/unused ") || !strings.Contains(out, "2 repositories") {
+		t.Fatalf("Expected both mirrors to be listed, but %q:", out)
+	}
+
+	output("prune", "Gomfile.lock")
+	roots, err := cacheMirrors(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0] != "example.com/a" {
+		t.Fatalf("Expected only example.com/a to be kept, but %v:", roots)
+	}
+	if lockfiles := knownLockfiles(cache); len(lockfiles) != 1 || lockfiles[0] != filepath.Join(dir, "Gomfile.lock") {
+		t.Fatalf("Expected the Gomfile.lock to be remembered, but %v:", lockfiles)
+	}
+
+	output("fill")
+	if !git.Contains(filepath.Join(cache, "example.com", "a"), rev) {
+		t.Fatalf("Expected the mirror to contain %s", rev)
+	}
+
+	if out := output("verify"); out != "example.com/a: ok\n" {
+		t.Fatalf("Expected %q, but %q:", "example.com/a: ok\n", out)
+	}
+}
@@ -5,21 +5,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 )
 
 var (
-	ErrStaledDependencies = fmt.Errorf("Dependencies staled. Run `gom install` to fix the issue")
+	ErrStaledDependencies   = fmt.Errorf("Dependencies staled. Run `gom install` to fix the issue")
+	ErrTamperedDependencies = fmt.Errorf("Vendored sources were modified. Delete the modified packages from the vendor folder and run `gom install` to restore them")
 )
 
-func getVcsCommand(vendor string, path string) (*vcsCmd, string, error) {
+func getVcsCommand(vendor string, path string) (VCS, string, error) {
 
 	for {
-		if isDir(filepath.Join(path, ".git")) {
-			return git, path, nil
-		} else if isDir(filepath.Join(path, ".hg")) {
-			return hg, path, nil
-		} else if isDir(filepath.Join(path, ".bzr")) {
-			return bzr, path, nil
+		if vcs := vcsAt(path); vcs != nil {
+			return vcs, path, nil
 		}
 
 		path = filepath.Clean(filepath.Join(path, ".."))
@@ -51,55 +50,367 @@ func locateGomfile() (string, error) {
 	return "", errors.New("Can't locate Gomfile")
 }
 
-func checkStaleness() error {
+// checkReport compares the installed copy of g with the revision and
+// checksum pinned by the Gomfile.
+func checkReport(vendor string, g Gom) packageReport {
+	report := packageReport{Name: g.name}
+	report.Pinned, _ = g.options["commit"].(string)
+
+	p := filepath.Join(vendor, "src", g.name)
+	if !isDir(p) {
+		report.Status = statusMissing
+		return report
+	}
+
+	vcs, path, err := getVcsCommand(vendor, p)
+	if err != nil {
+		// Sources installed from a bundle have no VCS metadata, their
+		// checksum tells whether they are the pinned ones.
+		expected, ok := g.options["checksum"].(string)
+		if sum, _ := checksumDir(p); ok && report.Pinned != "" && sum == expected {
+			report.Installed = report.Pinned
+			report.Status = statusOK
+			return report
+		}
+		report.Status = statusUnknownVCS
+		report.Error = err.Error()
+		return report
+	}
+
+	revision, err := vcs.Revision(path)
+	if err != nil {
+		report.Status = statusError
+		report.Error = err.Error()
+		return report
+	}
+	report.Installed = revision
+
+	changes, err := vcs.Status(path)
+	if err != nil {
+		report.Status = statusError
+		report.Error = err.Error()
+		return report
+	}
+	if len(changes) > 0 {
+		report.Status = statusDirty
+		report.Changes = changes
+		report.Error = summarizeChanges(changes)
+		return report
+	}
+
+	if url, ok := g.options["url"].(string); ok {
+		remote, _ := vcs.RemoteURL(path)
+		if remote != url {
+			report.Status = statusWrongURL
+			report.Error = fmt.Sprintf("Installed from %s", remote)
+			return report
+		}
+	}
+
+	if report.Pinned == "" {
+		report.Status = statusUnpinned
+		return report
+	}
+	if report.Pinned != revision {
+		report.Status = statusWrongRevision
+		return report
+	}
+
+	if expected, ok := g.options["checksum"].(string); ok {
+		sum, err := checksumDir(p)
+		if err != nil {
+			report.Status = statusError
+			report.Error = err.Error()
+			return report
+		}
+		if sum != expected {
+			report.Status = statusChecksumMismatch
+			report.Error = fmt.Sprintf("Expected %s, got %s", expected, sum)
+			return report
+		}
+	}
+
+	report.Status = statusOK
+	return report
+}
+
+// summarizeChanges counts the changes by kind, as in "2 modified, 1 untracked".
+func summarizeChanges(changes []fileChange) string {
+	summary := []string{}
+	for _, kind := range []string{changeModified, changeUntracked, changeDeleted} {
+		n := 0
+		for _, change := range changes {
+			if change.Kind == kind {
+				n++
+			}
+		}
+		if n > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	return strings.Join(summary, ", ")
+}
+
+// isStale tells whether a package needs `gom install`. Unpinned packages are
+// only warned about.
+func (report packageReport) isStale() bool {
+	return report.Status != statusOK && report.Status != statusUnpinned
+}
+
+// checkReports checks every package of the Gomfile found from the current
+// directory.
+func checkReports() ([]packageReport, error) {
 	gomfile, err := locateGomfile()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var allGoms []Gom
 	allGoms, err = parseGomfile(gomfile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, g := range allGoms {
-		rawCommit := g.options["commit"]
-		commit, ok := rawCommit.(string)
-		if !ok || commit == "" {
-			fmt.Printf("[%s] No commit set. Please set a revion with :commit => 'SHA1'\n", g.name)
-			continue
-		}
+	vendor, err := filepath.Abs(filepath.Join(filepath.Dir(gomfile), vendorFolder))
+	if err != nil {
+		return nil, err
+	}
+
+	// Packages of other groups and OSes aren't installed, so they aren't
+	// checked either.
+	reports := []packageReport{}
+	for _, g := range installableGoms(allGoms) {
+		reports = append(reports, checkReport(vendor, g))
+	}
+	return reports, nil
+}
 
-		vendor, err := filepath.Abs(filepath.Join(filepath.Dir(gomfile), vendorFolder))
+// checkStaleness checks every package and, if some aren't as the Gomfile
+// pins them, prints them all before failing.
+func checkStaleness() error {
+	reports, err := checkReports()
+	if err != nil {
+		return err
+	}
+	if *autoInstall {
+		reports, err = reinstallStale(reports)
 		if err != nil {
 			return err
 		}
+	}
+	problems := []packageReport{}
+	for _, report := range reports {
+		if report.Status != statusOK {
+			problems = append(problems, report)
+		}
+	}
+	if len(problems) > 0 {
+		printCheckTable(problems)
+	}
+	return stalenessError(reports, false)
+}
 
-		p := filepath.Join(vendor, "src", g.name)
-		if !isDir(p) {
-			return ErrStaledDependencies
+// staleGoms returns the packages of goms that a reinstall fixes: the missing
+// ones and the ones at another revision or from another URL. Local changes
+// are never discarded.
+func staleGoms(reports []packageReport, goms []Gom) []Gom {
+	stale := []Gom{}
+	for _, gom := range goms {
+		for _, report := range reports {
+			if report.Name != gom.name {
+				continue
+			}
+			switch report.Status {
+			case statusMissing, statusWrongRevision, statusWrongURL:
+				stale = append(stale, gom)
+			}
+			break
 		}
+	}
+	return stale
+}
 
-		vcs, path, err := getVcsCommand(vendor, p)
+// reinstallStale installs again the stale packages, leaving the others
+// alone, and returns the reports checked afterwards.
+func reinstallStale(reports []packageReport) ([]packageReport, error) {
+	gomfile, err := locateGomfile()
+	if err != nil {
+		return nil, err
+	}
+	allGoms, err := parseGomfile(gomfile)
+	if err != nil {
+		return nil, err
+	}
+	goms := staleGoms(reports, installableGoms(allGoms))
+	if len(goms) == 0 {
+		return reports, nil
+	}
+	names := []string{}
+	for _, gom := range goms {
+		names = append(names, gom.name)
+	}
+	fmt.Fprintf(stdout, "Reinstalling %d stale packages: %s\n", len(goms), strings.Join(names, ", "))
+
+	// Install from the directory of the Gomfile as `gom install` does, and
+	// leave the environment as it was for the command to run.
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, key := range []string{"GOPATH", "GOBIN", "PATH"} {
+		env[key] = os.Getenv(key)
+	}
+	defer func() {
+		for key, value := range env {
+			os.Setenv(key, value)
+		}
+		os.Chdir(cwd)
+	}()
+	err = os.Chdir(filepath.Dir(gomfile))
+	if err != nil {
+		return nil, err
+	}
+	err = prepareVendor()
+	if err != nil {
+		return nil, err
+	}
+	err = ready()
+	if err != nil {
+		return nil, err
+	}
+	err = installGoms(goms, []string{})
+	if err != nil {
+		return nil, err
+	}
+	return checkReports()
+}
+
+// stalenessError prints how many packages are stale and returns the error
+// to exit with, if any. Unless strict, packages with local changes are only
+// warned about: `gom install` keeps them, and editing a dependency in place
+// is how one tries a fix before sending it upstream.
+func stalenessError(reports []packageReport, strict bool) error {
+	stale, tampered := 0, 0
+	for _, report := range reports {
+		if report.Status == statusDirty && !strict {
+			continue
+		}
+		if report.isStale() {
+			stale++
+		}
+		if report.Status == statusDirty || report.Status == statusChecksumMismatch {
+			tampered++
+		}
+	}
+	if stale == 0 {
+		return nil
+	}
+	fmt.Fprintf(stdout, "%d of %d packages are stale\n", stale, len(reports))
+	if tampered == stale {
+		return ErrTamperedDependencies
+	}
+	return ErrStaledDependencies
+}
+
+// printCheckTable prints one line per package with its status and
+// revisions.
+func printCheckTable(reports []packageReport) {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tSTATUS\tPINNED\tINSTALLED\t")
+	for _, report := range reports {
+		pinned, installed := "-", "-"
+		if report.Pinned != "" {
+			pinned = shortRevision(report.Pinned)
+		}
+		if report.Installed != "" {
+			installed = shortRevision(report.Installed)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", report.Name, report.Status, pinned, installed, checkHint(report))
+	}
+	w.Flush()
+}
+
+// checkHint explains a status in the text output of `gom check`.
+func checkHint(report packageReport) string {
+	switch report.Status {
+	case statusUnpinned:
+		return "No commit set. Please set a revion with :commit => 'SHA1'"
+	case statusMissing:
+		return "Not installed"
+	case statusDirty:
+		return "Local changes: " + report.Error
+	case statusChecksumMismatch, statusUnknownVCS, statusWrongURL, statusError:
+		return report.Error
+	}
+	return ""
+}
+
+// printChanges lists the changed files of the dirty packages and, with
+// diff, the changes of their tracked files.
+func printChanges(vendor string, reports []packageReport, diff bool) error {
+	for _, report := range reports {
+		if report.Status != statusDirty {
+			continue
+		}
+		fmt.Fprintf(stdout, "\n%s\n", report.Name)
+		for _, change := range report.Changes {
+			fmt.Fprintf(stdout, "  %-9s %s\n", change.Kind, change.Path)
+		}
+		if !diff {
+			continue
+		}
+		vcs, path, err := getVcsCommand(vendor, filepath.Join(vendor, "src", report.Name))
 		if err != nil {
 			return err
 		}
-
-		if vcs == nil {
-			fmt.Printf("[%s] Unable to check the revision. Reason: unknown VCS\n", g.name)
+		d, ok := vcs.(differ)
+		if !ok {
+			fmt.Fprintf(stdout, "  (%s can't show the changes)\n", vcs.Name())
 			continue
 		}
+		err = d.Diff(path, stdout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		revision, err := vcs.Revision(path)
+// check implements `gom check`.
+func check(args []string) error {
+	fs, format := reportFlagSet("check")
+	diff := fs.Bool("diff", false, "show the local changes of dirty packages")
+	_, err := parseReportFlags(fs, format, args)
+	if err != nil {
+		return err
+	}
+
+	reports, err := checkReports()
+	if err != nil {
+		return err
+	}
+	if *format == formatText {
+		printCheckTable(reports)
+		gomfile, err := locateGomfile()
 		if err != nil {
 			return err
 		}
+		err = printChanges(filepath.Join(filepath.Dir(gomfile), vendorFolder), reports, *diff)
+		if err != nil {
+			return err
+		}
+		return stalenessError(reports, true)
+	}
 
-		if commit != revision {
+	err = writeReports(stdout, *format, reports)
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if report.isStale() {
 			return ErrStaledDependencies
 		}
 	}
-
 	return nil
 }
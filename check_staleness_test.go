@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckReports(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	revs := map[string]string{}
+	for _, name := range []string{"a", "b", "d", "e", "f"} {
+		revs[name] = gitRepo(t, filepath.Join(dir, vendorFolder, "src", "example.com", name))
+	}
+	b := filepath.Join(dir, vendorFolder, "src", "example.com", "b")
+	if err := ioutil.WriteFile(filepath.Join(b, "x.go"), []byte("package x // modified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := filepath.Join(dir, vendorFolder, "src", "example.com", "e")
+	gitCmd(t, e, "commit", "-q", "--allow-empty", "-m", "second")
+	sum := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	err := ioutil.WriteFile("Gomfile", []byte(`
+gom 'example.com/a', :commit => '`+revs["a"]+`'
+gom 'example.com/b', :commit => '`+revs["b"]+`'
+gom 'example.com/c', :commit => '`+revs["a"]+`'
+gom 'example.com/d', :commit => '`+revs["d"]+`', :checksum => '`+sum+`'
+gom 'example.com/e', :commit => '`+revs["a"]+`'
+gom 'example.com/f'
+gom 'example.com/g', :commit => '`+revs["a"]+`', :goos => 'plan10'
+gom 'example.com/h', :commit => '`+revs["a"]+`', :group => 'nonexistent'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := checkReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := []string{}
+	for _, report := range reports {
+		statuses = append(statuses, report.Status)
+	}
+	expected := []string{statusOK, statusDirty, statusMissing, statusChecksumMismatch, statusWrongRevision, statusUnpinned}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, statuses)
+	}
+
+	if changes := reports[1].Changes; !reflect.DeepEqual(changes, []fileChange{{"x.go", changeModified}}) {
+		t.Fatalf("Expected x.go to be modified, but %v:", changes)
+	}
+
+	f, err := ioutil.TempFile("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	oldstdout := stdout
+	stdout = f
+	err = checkStaleness()
+	stdout = oldstdout
+	f.Close()
+	if err != ErrStaledDependencies {
+		t.Fatalf("Expected %v, but %v:", ErrStaledDependencies, err)
+	}
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("Expected a header, 5 packages and a count, but %q:", lines)
+	}
+	if strings.Contains(string(out), "example.com/a ") {
+		t.Fatalf("Expected only the packages with problems, but %q:", out)
+	}
+	if lines[6] != "3 of 6 packages are stale" {
+		t.Fatalf("Expected %q, but %q:", "3 of 6 packages are stale", lines[6])
+	}
+}
+
+func TestStalenessErrorDirty(t *testing.T) {
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devnull.Close()
+	oldstdout := stdout
+	stdout = devnull
+	defer func() { stdout = oldstdout }()
+
+	reports := []packageReport{
+		{Name: "a", Status: statusOK},
+		{Name: "b", Status: statusDirty},
+	}
+	if err := stalenessError(reports, false); err != nil {
+		t.Fatalf("Expected %v, but %v:", nil, err)
+	}
+	if err := stalenessError(reports, true); err != ErrTamperedDependencies {
+		t.Fatalf("Expected %v, but %v:", ErrTamperedDependencies, err)
+	}
+}
+
+func TestVcsChanges(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	gitRepo(t, dir)
+	if err := ioutil.WriteFile("y.go", []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "add", "y.go")
+	gitCmd(t, dir, "commit", "-q", "-m", "y")
+	if err := ioutil.WriteFile("x.go", []byte("package x // modified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("y.go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("z.go", []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := git.Status(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []fileChange{
+		{"x.go", changeModified},
+		{"y.go", changeDeleted},
+		{"z.go", changeUntracked},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, changes)
+	}
+	if summary := summarizeChanges(changes); summary != "1 modified, 1 untracked, 1 deleted" {
+		t.Fatalf("Expected %q, but %q:", "1 modified, 1 untracked, 1 deleted", summary)
+	}
+
+	var diff bytes.Buffer
+	if err := git.Diff(dir, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.String(), "+package x // modified") {
+		t.Fatalf("Expected the diff of x.go, but %q:", diff.String())
+	}
+}
+
+func TestStaleGoms(t *testing.T) {
+	reports := []packageReport{
+		{Name: "a", Status: statusOK},
+		{Name: "b", Status: statusMissing},
+		{Name: "c", Status: statusDirty},
+		{Name: "d", Status: statusWrongRevision},
+		{Name: "e", Status: statusChecksumMismatch},
+		{Name: "f", Status: statusUnpinned},
+	}
+	goms := []Gom{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}, {name: "e"}, {name: "f"}}
+	stale := staleGoms(reports, goms)
+	names := []string{}
+	for _, gom := range stale {
+		names = append(names, gom.name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "d"}) {
+		t.Fatalf("Expected %v, but %v:", []string{"b", "d"}, names)
+	}
+}
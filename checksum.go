@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// vcsMetadata lists the files and directories where VCS keep their own data.
+// They change with every fetch and are left out of checksums.
+var vcsMetadata = []string{".git", ".hg", ".bzr", ".svn", "_FOSSIL_", ".fslckout"}
+
+// checksumDir returns a hash of the source tree under dir: the path and
+// content of every file, except VCS metadata.
+func checksumDir(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if has(vcsMetadata, fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sum, err := checksumFile(p, fi)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%x  %s\n", sum, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// checksumFile hashes the content of a file, or the target of a symlink.
+func checksumFile(p string, fi os.FileInfo) ([]byte, error) {
+	h := sha256.New()
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(h, target)
+		return h.Sum(nil), nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
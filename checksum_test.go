@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package a")
+	write("sub/b.go", "package sub")
+	write(".git/HEAD", "ref: refs/heads/master")
+
+	sum, err := checksumDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(".git/HEAD", "ref: refs/heads/other")
+	if other, _ := checksumDir(dir); other != sum {
+		t.Fatalf("Expected VCS metadata to be ignored: %s != %s", other, sum)
+	}
+
+	write("sub/b.go", "package sub // modified")
+	if other, _ := checksumDir(dir); other == sum {
+		t.Fatal("Expected a modified file to change the checksum")
+	}
+
+	write("sub/b.go", "package sub")
+	if err := os.Rename(filepath.Join(dir, "sub", "b.go"), filepath.Join(dir, "sub", "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := checksumDir(dir); other == sum {
+		t.Fatal("Expected a renamed file to change the checksum")
+	}
+}
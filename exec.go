@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -93,3 +96,37 @@ func run(args []string, c Color) error {
 	ct.ResetColor()
 	return err
 }
+
+// runner runs the commands needed to install a package. Its output goes to
+// the given writers so that packages installed concurrently don't interleave
+// their logs, and its commands are killed once ctx is cancelled.
+type runner struct {
+	ctx    context.Context
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+	color  bool // whether the output goes straight to the terminal
+}
+
+// directRunner returns a runner attached to the terminal.
+func directRunner() *runner {
+	return &runner{context.Background(), stdout, stderr, stdin, true}
+}
+
+func (r *runner) printf(format string, a ...interface{}) {
+	fmt.Fprintf(r.stdout, format, a...)
+}
+
+// run executes args in dir, or in the current directory if dir is empty.
+func (r *runner) run(dir string, c Color, args ...string) error {
+	cmd := exec.CommandContext(r.ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = r.stdout
+	cmd.Stderr = r.stderr
+	cmd.Stdin = r.stdin
+	if r.color {
+		ct.ChangeColor(ct.Color(c), true, ct.None, false)
+		defer ct.ResetColor()
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	ErrLockOutOfDate = errors.New("Gomfile.lock doesn't match the Gomfile. Run `gom lock` to update it")
+)
+
+// lockedOptions are the options gom lock adds to the entries of the lock.
+// They only count as differences when the Gomfile sets them too.
+var lockedOptions = []string{"commit", "checksum", "vcs", "url"}
+
+// checkFrozen fails when the lock of the given Gomfile is missing or doesn't
+// list the same packages with the same options, after printing the
+// differences.
+func checkFrozen(filename string) error {
+	if !isFile(filename + ".lock") {
+		return fmt.Errorf("%s.lock is missing. Run `gom lock` to create it", filename)
+	}
+	gomfile, err := readAllGoms(filename)
+	if err != nil {
+		return err
+	}
+	lock, err := readAllGoms(filename + ".lock")
+	if err != nil {
+		return err
+	}
+	diff := diffGoms(gomfile, lock)
+	if len(diff) == 0 {
+		return nil
+	}
+	fmt.Printf("%s and %s.lock disagree:\n", filename, filename)
+	for _, line := range diff {
+		fmt.Printf("  %s\n", line)
+	}
+	return ErrLockOutOfDate
+}
+
+// diffGoms lists the packages added, removed and changed in the Gomfile
+// compared to its lock.
+func diffGoms(gomfile, lock []Gom) []string {
+	locked := make(map[string]Gom)
+	for _, g := range lock {
+		locked[g.name] = g
+	}
+
+	diff := []string{}
+	for _, g := range gomfile {
+		l, ok := locked[g.name]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("+ %s: added to the Gomfile", g.name))
+			continue
+		}
+		delete(locked, g.name)
+		diff = append(diff, diffGom(g, l)...)
+	}
+
+	removed := []string{}
+	for name := range locked {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		diff = append(diff, fmt.Sprintf("- %s: removed from the Gomfile", name))
+	}
+	return diff
+}
+
+// diffGom lists the options of a package which differ between the Gomfile
+// and its lock.
+func diffGom(g, l Gom) []string {
+	keys := []string{}
+	for key := range g.options {
+		keys = append(keys, key)
+	}
+	for key := range l.options {
+		if _, ok := g.options[key]; !ok && !has(lockedOptions, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diff := []string{}
+	for _, key := range keys {
+		want, inGomfile := g.options[key]
+		got, inLock := l.options[key]
+		switch {
+		case !inLock:
+			diff = append(diff, fmt.Sprintf("~ %s: :%s => %s is not in the lock", g.name, key, formatOptionValue(want)))
+		case !inGomfile:
+			diff = append(diff, fmt.Sprintf("~ %s: :%s => %s is not in the Gomfile", g.name, key, formatOptionValue(got)))
+		case key == "tag" && isVersionConstraint(fmt.Sprint(want)) && tagSatisfies(fmt.Sprint(want), fmt.Sprint(got)):
+			// The lock holds the tag the constraint was resolved to.
+		case !reflect.DeepEqual(want, got):
+			diff = append(diff, fmt.Sprintf("~ %s: :%s => %s in the Gomfile, %s in the lock", g.name, key, formatOptionValue(want), formatOptionValue(got)))
+		}
+	}
+	return diff
+}
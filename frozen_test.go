@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffGoms(t *testing.T) {
+	gomfile := []Gom{
+		{name: "example.com/same", options: map[string]interface{}{"tag": "v1"}},
+		{name: "example.com/added", options: map[string]interface{}{}},
+		{name: "example.com/constrained", options: map[string]interface{}{"tag": "~> 1.0"}},
+		{name: "example.com/repinned", options: map[string]interface{}{"commit": "new", "private": "true"}},
+		{name: "example.com/other-os", options: map[string]interface{}{"goos": "plan10"}},
+	}
+	lock := []Gom{
+		{name: "example.com/same", options: map[string]interface{}{"tag": "v1", "commit": "abc", "vcs": "git", "checksum": "sha256:00"}},
+		{name: "example.com/constrained", options: map[string]interface{}{"tag": "v1.2.0", "commit": "abc"}},
+		{name: "example.com/repinned", options: map[string]interface{}{"commit": "old", "target": "example.com/x"}},
+		{name: "example.com/removed", options: map[string]interface{}{"commit": "abc"}},
+		{name: "example.com/other-os", options: map[string]interface{}{"goos": "plan10", "commit": "abc"}},
+	}
+	expected := []string{
+		"+ example.com/added: added to the Gomfile",
+		"~ example.com/repinned: :commit => 'new' in the Gomfile, 'old' in the lock",
+		"~ example.com/repinned: :private => 'true' is not in the lock",
+		"~ example.com/repinned: :target => 'example.com/x' is not in the Gomfile",
+		"- example.com/removed: removed from the Gomfile",
+	}
+	diff := diffGoms(gomfile, lock)
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("Expected %q, but %q:", expected, diff)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"go/build"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -106,59 +109,203 @@ func genGomfile(directory string) error {
 }
 
 func genGomfileLock() error {
-	allGoms, err := parseGomfile("Gomfile")
+	_, err := writeLockfile()
 	if err != nil {
 		return err
 	}
-	vendor, err := filepath.Abs(vendorFolder)
+	fmt.Println("Gomfile.lock is generated")
+	return nil
+}
+
+// lock implements `gom lock`.
+func lock(args []string) error {
+	format, err := parseFormatArgs("lock", args)
 	if err != nil {
 		return err
 	}
-	goms := make([]Gom, 0)
-	for _, gom := range allGoms {
-		if group, ok := gom.options["group"]; ok {
-			if !matchEnv(group) {
-				continue
+	if format == formatText {
+		return genGomfileLock()
+	}
+	reports, err := writeLockfile()
+	if err != nil {
+		return err
+	}
+	return writeReports(stdout, format, reports)
+}
+
+// writeLockfile generates Gomfile.lock and reports how every package was
+// locked.
+func writeLockfile() ([]packageReport, error) {
+	b, err := ioutil.ReadFile("Gomfile")
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseGomfileSource("Gomfile", b)
+	if err != nil {
+		return nil, err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	// Packages which aren't installed here, because they belong to other
+	// groups or OSes, keep what the previous lock recorded for them.
+	lw := &lockWriter{vendor: vendor, previous: make(map[string]Gom)}
+	if b, err := ioutil.ReadFile("Gomfile.lock"); err == nil {
+		if lock, err := parseGomfileSource("Gomfile.lock", b); err == nil {
+			for _, gom := range declaredGoms(lock.Stmts, nil) {
+				lw.previous[gom.name] = gom
 			}
 		}
-		if goos, ok := gom.options["goos"]; ok {
-			if !matchOS(goos) {
+	}
+
+	var buf bytes.Buffer
+	err = lw.write(&buf, file.Stmts, "")
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile("Gomfile.lock", buf.Bytes(), 0644)
+	if err != nil {
+		return nil, err
+	}
+	rememberLockfile("Gomfile.lock")
+	return lw.reports, nil
+}
+
+// lockWriter writes the entries of Gomfile.lock and reports what it locked.
+type lockWriter struct {
+	vendor   string
+	previous map[string]Gom
+	reports  []packageReport
+}
+
+// write writes the lock entries of all the packages declared in stmts,
+// whatever their group and OS, keeping their group blocks.
+func (lw *lockWriter) write(w io.Writer, stmts []Stmt, indent string) error {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *GomDecl:
+			gom := Gom{stmt.Name.Value, stmt.options()}
+			report, err := lw.lockGom(&gom)
+			if err != nil {
+				return err
+			}
+			lw.reports = append(lw.reports, report)
+			fmt.Fprintf(w, "%s%s\n", indent, gom.GomfileEntry())
+		case *GroupDecl:
+			groups := stmt.groupNames()
+			var body bytes.Buffer
+			err := lw.write(&body, stmt.Body, indent+"  ")
+			if err != nil {
+				return err
+			}
+			if body.Len() == 0 {
 				continue
 			}
-		}
-		goms = append(goms, gom)
-	}
-
-	for _, gom := range goms {
-		var vcs *vcsCmd
-		p := filepath.Join(vendor, "src", gom.name)
-		if isDir(filepath.Join(p, ".git")) {
-			vcs = git
-		} else if isDir(filepath.Join(p, ".hg")) {
-			vcs = hg
-		} else if isDir(filepath.Join(p, ".bzr")) {
-			vcs = bzr
-		}
-		if vcs != nil {
-			rev, err := vcs.Revision(p)
-			if err == nil && rev != "" {
-				gom.options["commit"] = rev
+			for i := range groups {
+				groups[i] = ":" + groups[i]
 			}
-
+			fmt.Fprintf(w, "%sgroup %s do\n%s%send\n", indent, strings.Join(groups, ", "), body.Bytes(), indent)
 		}
 	}
-	f, err := os.Create("Gomfile.lock")
+	return nil
+}
+
+// urlLockable tells whether the checkout in dir is where gom install puts
+// the repository of :url for the package name, see Gom.repo.
+func urlLockable(vendor, name, dir string) bool {
+	root, err := filepath.Rel(filepath.Join(vendor, "src"), dir)
 	if err != nil {
-		return err
+		return false
 	}
-	defer f.Close()
-	for _, gom := range goms {
-		if rev, ok := gom.options["commit"]; ok {
-			fmt.Fprintf(f, "gom '%s', :commit => '%s'\n", gom.name, rev.(string))
-		} else {
-			fmt.Fprintf(f, "gom '%s'\n", gom.name)
+	root = filepath.ToSlash(root)
+	if repo := staticRepo(name); repo != nil {
+		return root == repo.root
+	}
+	return root == name
+}
+
+// tagsAt returns the tags of the repository in root pointing at rev, so that
+// the lock holds the tag of the installed commit rather than a newer one.
+// VCS which can't tell only get the tag of the previous lock if it pinned
+// rev too.
+func (lw *lockWriter) tagsAt(name string, vcs VCS, root, rev string) []string {
+	if t, ok := vcs.(tagPointer); ok {
+		if tags, err := t.TagsAt(root, rev); err == nil {
+			return tags
 		}
 	}
-	fmt.Println("Gomfile.lock is generated")
+	prev := lw.previous[name]
+	if tag, ok := prev.options["tag"].(string); ok && prev.options["commit"] == rev {
+		return []string{tag}
+	}
 	return nil
 }
+
+// lockGom records in the options of gom how its installed copy was fetched:
+// the revision, VCS and URL of its repository, and the checksum of its sources.
+// When gom isn't installed, the previous lock entry is used as long as the
+// Gomfile still declares gom the same way.
+func (lw *lockWriter) lockGom(gom *Gom) (packageReport, error) {
+	report := packageReport{Name: gom.name, Status: statusNotInstalled}
+
+	p := filepath.Join(lw.vendor, "src", gom.name)
+	if !isDir(p) {
+		if prev, ok := lw.previous[gom.name]; ok && len(diffGom(*gom, prev)) == 0 {
+			for _, key := range lockedOptions {
+				if _, ok := gom.options[key]; !ok && prev.options[key] != nil {
+					gom.options[key] = prev.options[key]
+				}
+			}
+			if tag, ok := gom.options["tag"].(string); ok && isVersionConstraint(tag) {
+				gom.options["tag"] = prev.options["tag"]
+			}
+			report.Status = statusPrevious
+		}
+		report.Pinned, _ = gom.options["commit"].(string)
+		return report, nil
+	}
+	if vcs, root, err := getVcsCommand(lw.vendor, p); err == nil {
+		rev, err := vcs.Revision(root)
+		if err == nil && rev != "" {
+			gom.options["commit"] = rev
+			report.Installed = rev
+		}
+		if tag, ok := gom.options["tag"].(string); ok && isVersionConstraint(tag) && rev != "" {
+			resolved, err := resolveVersion(tag, lw.tagsAt(gom.name, vcs, root, rev))
+			if err != nil {
+				return report, fmt.Errorf("%s: %v", gom.name, err)
+			}
+			if resolved != "" {
+				gom.options["tag"] = resolved
+			}
+		}
+		// A declared :url and :vcs stay as they are, and the URL is only
+		// recorded when installing from it puts the repository at root.
+		if !has(gom.options, "url") && urlLockable(lw.vendor, gom.name, root) {
+			if url, err := vcs.RemoteURL(root); err == nil && url != "" {
+				gom.options["url"] = url
+			}
+		}
+		if !has(gom.options, "vcs") {
+			gom.options["vcs"] = vcs.Name()
+		}
+	}
+	sum, err := checksumDir(p)
+	if err != nil {
+		return report, err
+	}
+	gom.options["checksum"] = sum
+	report.Status = statusLocked
+	report.Pinned, _ = gom.options["commit"].(string)
+	return report, nil
+}
+
+// refreshGomfileLock regenerates Gomfile.lock when the project has one.
+func refreshGomfileLock() error {
+	if !isFile("Gomfile.lock") {
+		return nil
+	}
+	return genGomfileLock()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// gitCmd runs git in dir and returns its trimmed output.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=gom", "-c", "user.email=gom@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, b)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// gitRepo creates a git repository in dir with a single commit and returns
+// the revision of that commit.
+func gitRepo(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "commit", "-q", "-m", "initial")
+	return gitCmd(t, dir, "rev-parse", "HEAD")
+}
+
+// chdirTemp moves to a new temporary directory and returns it along with the
+// function to go back and remove it.
+func chdirTemp(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		os.Chdir(cwd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGenGomfileLock(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	rev := gitRepo(t, filepath.Join(dir, vendorFolder, "src", "example.com", "a"))
+	gitCmd(t, filepath.Join(dir, vendorFolder, "src", "example.com", "a"), "remote", "add", "origin", "https://example.com/a.git")
+	sum, err := checksumDir(filepath.Join(dir, vendorFolder, "src", "example.com", "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile("Gomfile", []byte(`
+# comments are dropped
+group :development, :test do
+  gom 'example.com/a', :private => 'true', :branch => 'master', :goos => [:`+runtime.GOOS+`]
+  gom 'example.com/b', :goos => 'plan10'
+end
+group :production do
+  gom 'example.com/c'
+end
+gom 'example.com/d', :command => 'git clone http://example.com/d.git', :target => 'example.com/e'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b is for another OS and keeps its previous pin, c changed since.
+	err = ioutil.WriteFile("Gomfile.lock", []byte(`
+group :test do
+  gom 'example.com/b', :commit => 'bbb', :goos => 'plan10', :vcs => 'git'
+end
+gom 'example.com/c', :commit => 'ccc', :tag => 'v0'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*developmentEnv = true
+	err = genGomfileLock()
+	*developmentEnv = false
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile("Gomfile.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `group :development, :test do
+  gom 'example.com/a', :commit => '` + rev + `', :private => 'true', :branch => 'master', :checksum => '` + sum + `', :goos => [:` + runtime.GOOS + `], :url => 'https://example.com/a.git', :vcs => 'git'
+  gom 'example.com/b', :commit => 'bbb', :goos => 'plan10', :vcs => 'git'
+end
+group :production do
+  gom 'example.com/c'
+end
+gom 'example.com/d', :command => 'git clone http://example.com/d.git', :target => 'example.com/e'
+`
+	if string(b) != expected {
+		t.Fatalf("Expected %q, but %q:", expected, b)
+	}
+}
+
+func TestInstallFromLock(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache, oldClient := os.Getenv("GOM_CACHE"), httpClient
+	defer func() {
+		os.Setenv("GOM_CACHE", oldcache)
+		httpClient = oldClient
+	}()
+	os.Setenv("GOM_CACHE", "off")
+
+	origin := filepath.Join(dir, "origin")
+	rev1 := gitRepo(t, origin)
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	dest := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	gitCmd(t, dir, "clone", "-q", origin, dest)
+	gitCmd(t, dest, "checkout", "-q", rev1)
+	if err := ioutil.WriteFile("Gomfile", []byte("gom 'example.com/a'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := genGomfileLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A clean machine installs what was locked without asking example.com.
+	os.RemoveAll(filepath.Join(dir, vendorFolder, "src"))
+	httpClient = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("Expected %s not to be asked", req.URL)
+		return nil, errors.New("no network")
+	})}
+	goms, err := parseGomfile("Gomfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gom := range goms {
+		if err := gom.Clone(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if err := gom.Checkout(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if report := checkReport(filepath.Join(dir, vendorFolder), gom); report.Status != statusOK {
+			t.Fatalf("Expected %v, but %v %v:", statusOK, report.Status, report.Error)
+		}
+	}
+	if url, _ := git.RemoteURL(dest); url != origin {
+		t.Fatalf("Expected %v, but %v:", origin, url)
+	}
+}
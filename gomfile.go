@@ -1,33 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"os"
-	"regexp"
+	"io/ioutil"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 )
 
-var qx = `'[^']*'|"[^"]*"`
-var kx = `:[a-z][a-z0-9_]*`
-var ax = `(?:\s*` + kx + `\s*|,\s*` + kx + `\s*)`
-var re_group = regexp.MustCompile(`\s*group\s+((?:` + kx + `\s*|,\s*` + kx + `\s*)*)\s*do\s*$`)
-var re_end = regexp.MustCompile(`\s*end\s*$`)
-var re_gom = regexp.MustCompile(`^\s*gom\s+(` + qx + `)\s*((?:,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*))*)$`)
-var re_options = regexp.MustCompile(`(,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*)\s*)`)
-
-func unquote(name string) string {
-	name = strings.TrimSpace(name)
-	if len(name) > 2 {
-		if (name[0] == '\'' && name[len(name)-1] == '\'') || (name[0] == '"' && name[len(name)-1] == '"') {
-			return name[1 : len(name)-1]
-		}
-	}
-	return name
-}
-
 func matchOS(any interface{}) bool {
 	var envs []string
 	if as, ok := any.([]string); ok {
@@ -71,123 +52,134 @@ func matchEnv(any interface{}) bool {
 	return false
 }
 
-func parseOptions(line string, options map[string]interface{}) {
-	ss := re_options.FindAllStringSubmatch(line, -1)
-	re_a := regexp.MustCompile(ax)
-	for _, s := range ss {
-		kvs := strings.SplitN(strings.TrimSpace(s[0])[1:], "=>", 2)
-		kvs[0], kvs[1] = strings.TrimSpace(kvs[0]), strings.TrimSpace(kvs[1])
-		if kvs[1][0] == '[' {
-			as := re_a.FindAllStringSubmatch(kvs[1][1:len(kvs[1])-1], -1)
-			a := []string{}
-			for i := range as {
-				it := strings.TrimSpace(as[i][0])
-				if strings.HasPrefix(it, ",") {
-					it = strings.TrimSpace(it[1:])
-				}
-				if strings.HasPrefix(it, ":") {
-					it = strings.TrimSpace(it[1:])
-				}
-				a = append(a, it)
-			}
-			options[kvs[0][1:]] = a
-		} else {
-			options[kvs[0][1:]] = unquote(kvs[1])
-		}
-	}
-}
-
 type Gom struct {
 	name    string
 	options map[string]interface{}
 }
 
+// gomfileOptionOrder is the order in which well known options are written,
+// other options follow sorted by name.
+var gomfileOptionOrder = []string{"commit", "private", "command", "branch", "target", "tag"}
+
 func (g Gom) GomfileEntry() string {
-	s := fmt.Sprintf("gom '%s'", g.name)
-	if commit, ok := g.options["commit"]; ok {
-		s += fmt.Sprintf(", :commit => '%s'", commit)
+	s := fmt.Sprintf("gom %s", quoteGomfileString(g.name))
+	keys := make([]string, 0, len(g.options))
+	for _, key := range gomfileOptionOrder {
+		if _, ok := g.options[key]; ok {
+			keys = append(keys, key)
+		}
 	}
-	if private, ok := g.options["private"]; ok {
-		s += fmt.Sprintf(", :private => '%s'", private)
+	others := make([]string, 0, len(g.options))
+	for key := range g.options {
+		if !has(gomfileOptionOrder, key) {
+			others = append(others, key)
+		}
 	}
-	if command, ok := g.options["command"]; ok {
-		s += fmt.Sprintf(", :command => '%s'", command)
+	sort.Strings(others)
+	for _, key := range append(keys, others...) {
+		s += fmt.Sprintf(", :%s => %s", key, formatOptionValue(g.options[key]))
 	}
-	if branch, ok := g.options["branch"]; ok {
-		s += fmt.Sprintf(", :branch => '%s'", branch)
+	return s
+}
+
+// formatOptionValue formats an option value the way it is written in a
+// Gomfile: lists become [:a, :b] and everything else a quoted string.
+func formatOptionValue(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if isSymbolName(item) {
+				items = append(items, ":"+item)
+			} else {
+				items = append(items, quoteGomfileString(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
 	}
-	if target, ok := g.options["target"]; ok {
-		s += fmt.Sprintf(", :target => '%s'", target)
+	return quoteGomfileString(fmt.Sprint(v))
+}
+
+func quoteGomfileString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+func isSymbolName(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
 	}
-	if tag, ok := g.options["tag"]; ok {
-		s += fmt.Sprintf(", :tag => '%s'", tag)
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
 	}
-	return s
+	return true
 }
 
+// parseGomfile returns the packages selected by the Gomfile, reading its lock
+// file instead when there is one.
 func parseGomfile(filename string) ([]Gom, error) {
-	f, err := os.Open(filename + ".lock")
+	if isFile(filename + ".lock") {
+		filename += ".lock"
+	}
+	return readGomfile(filename)
+}
+
+// readGomfile returns the packages selected by the given file.
+func readGomfile(filename string) ([]Gom, error) {
+	b, err := ioutil.ReadFile(filename)
 	if err != nil {
-		f, err = os.Open(filename)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
-	br := bufio.NewReader(f)
 
-	goms := make([]Gom, 0)
+	file, err := parseGomfileSource(filepath.Base(filename), b)
+	if err != nil {
+		return nil, err
+	}
+	return selectGoms(file.Stmts, make([]Gom, 0)), nil
+}
 
-	n := 0
-	skip := 0
-	valid := true
-	for {
-		n++
-		lb, _, err := br.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				return goms, nil
+// readAllGoms returns all the packages declared in the given file, whatever
+// their group.
+func readAllGoms(filename string) ([]Gom, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseGomfileSource(filepath.Base(filename), b)
+	if err != nil {
+		return nil, err
+	}
+	return declaredGoms(file.Stmts, make([]Gom, 0)), nil
+}
+
+// selectGoms appends to goms the packages declared in stmts, skipping the
+// groups which don't match the selected environments.
+func selectGoms(stmts []Stmt, goms []Gom) []Gom {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *GomDecl:
+			goms = append(goms, Gom{stmt.Name.Value, stmt.options()})
+		case *GroupDecl:
+			if matchEnv(stmt.groupNames()) {
+				goms = selectGoms(stmt.Body, goms)
 			}
-			return nil, err
-		}
-		line := strings.TrimSpace(string(lb))
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
 		}
+	}
+	return goms
+}
 
-		name := ""
-		options := make(map[string]interface{})
-		var items []string
-		if re_group.MatchString(line) {
-			envs := strings.Split(re_group.FindStringSubmatch(line)[1], ",")
-			for i := range envs {
-				envs[i] = strings.TrimSpace(envs[i])[1:]
-			}
-			if matchEnv(envs) {
-				valid = true
-				continue
-			}
-			valid = false
-			skip++
-			continue
-		} else if re_end.MatchString(line) {
-			if !valid {
-				skip--
-				if skip < 0 {
-					return nil, fmt.Errorf("Syntax Error at line %d", n)
-				}
-			}
-			valid = false
-			continue
-		} else if skip > 0 {
-			continue
-		} else if re_gom.MatchString(line) {
-			items = re_gom.FindStringSubmatch(line)[1:]
-			name = unquote(items[0])
-			parseOptions(items[1], options)
-		} else {
-			return nil, fmt.Errorf("Syntax Error at line %d", n)
+// declaredGoms appends to goms all the packages declared in stmts, whatever
+// their group.
+func declaredGoms(stmts []Stmt, goms []Gom) []Gom {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *GomDecl:
+			goms = append(goms, Gom{stmt.Name.Value, stmt.options()})
+		case *GroupDecl:
+			goms = declaredGoms(stmt.Body, goms)
 		}
-		goms = append(goms, Gom{name, options})
 	}
-	return goms, nil
+	return goms
 }
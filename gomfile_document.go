@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Document is an editable Gomfile. Edits only rewrite the bytes of the
+// declarations they change, so comments, blank lines, groups and the order
+// of everything else are kept as written.
+type Document struct {
+	filename string
+	src      []byte
+	file     *File
+}
+
+func readDocument(filename string) (*Document, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newDocument(filename, b)
+}
+
+func newDocument(filename string, src []byte) (*Document, error) {
+	file, err := parseGomfileSource(filepath.Base(filename), src)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{filename: filename, src: src, file: file}, nil
+}
+
+// Bytes returns the current content of the document.
+func (d *Document) Bytes() []byte {
+	return d.src
+}
+
+// Save writes the document back to the file it was read from.
+func (d *Document) Save() error {
+	return ioutil.WriteFile(d.filename, d.src, 0644)
+}
+
+// Lookup returns the declaration of the named package and the groups it
+// belongs to, or nil if the package isn't declared.
+func (d *Document) Lookup(name string) (*GomDecl, []string) {
+	return lookupGom(d.file.Stmts, name, nil)
+}
+
+func lookupGom(stmts []Stmt, name string, groups []string) (*GomDecl, []string) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *GomDecl:
+			if stmt.Name.Value == name {
+				return stmt, groups
+			}
+		case *GroupDecl:
+			if decl, g := lookupGom(stmt.Body, name, append(groups, stmt.groupNames()...)); decl != nil {
+				return decl, g
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SetOption sets the option key of the named package, replacing the value in
+// place when the option is already present and appending it otherwise.
+func (d *Document) SetOption(name, key string, value interface{}) error {
+	decl, _ := d.Lookup(name)
+	if decl == nil {
+		return fmt.Errorf("%s is not in %s", name, d.file.Name)
+	}
+	for _, opt := range decl.Options {
+		if opt.Key.Value == key {
+			return d.replace(opt.Value.Pos().Offset, opt.Value.End().Offset, formatOptionValue(value))
+		}
+	}
+	end := decl.Name.End()
+	if n := len(decl.Options); n > 0 {
+		end = decl.Options[n-1].End()
+	}
+	return d.replace(end.Offset, end.Offset, fmt.Sprintf(", :%s => %s", key, formatOptionValue(value)))
+}
+
+// RemoveOption removes the option key of the named package if it is set.
+func (d *Document) RemoveOption(name, key string) error {
+	decl, _ := d.Lookup(name)
+	if decl == nil {
+		return fmt.Errorf("%s is not in %s", name, d.file.Name)
+	}
+	prev := decl.Name.End()
+	for _, opt := range decl.Options {
+		if opt.Key.Value == key {
+			return d.replace(prev.Offset, opt.End().Offset, "")
+		}
+		prev = opt.End()
+	}
+	return nil
+}
+
+// Add declares a new package. Packages with groups are added at the end of
+// the first group block declaring exactly those groups, which is created at
+// the end of the file if needed; other packages go after the last top level
+// declaration.
+func (d *Document) Add(g Gom, groups []string) error {
+	if decl, _ := d.Lookup(g.name); decl != nil {
+		return fmt.Errorf("%s is already in %s", g.name, d.file.Name)
+	}
+	entry := g.GomfileEntry()
+
+	if len(groups) == 0 {
+		var last Stmt
+		for _, stmt := range d.file.Stmts {
+			if _, ok := stmt.(*GomDecl); ok {
+				last = stmt
+			}
+		}
+		if last == nil {
+			return d.appendLines(entry + "\n")
+		}
+		at := d.lineEnd(last.End().Offset)
+		return d.replace(at, at, d.lineIndent(last.Pos().Offset)+entry+"\n")
+	}
+
+	for _, stmt := range d.file.Stmts {
+		group, ok := stmt.(*GroupDecl)
+		if !ok || !sameGroups(group.groupNames(), groups) {
+			continue
+		}
+		indent := d.lineIndent(group.GroupPos.Offset) + "  "
+		for _, s := range group.Body {
+			if _, ok := s.(*GomDecl); ok {
+				indent = d.lineIndent(s.Pos().Offset)
+			}
+		}
+		at := d.lineStart(group.EndPos.Offset)
+		return d.replace(at, at, indent+entry+"\n")
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, ":"+group)
+	}
+	block := fmt.Sprintf("group %s do\n  %s\nend\n", strings.Join(names, ", "), entry)
+	if len(d.file.Stmts) > 0 {
+		block = "\n" + block
+	}
+	return d.appendLines(block)
+}
+
+// Remove deletes the declaration of the named package along with the lines
+// it occupies. Group blocks left empty are deleted too, with the blank line
+// separating them from what precedes.
+func (d *Document) Remove(name string) error {
+	decl, _ := d.Lookup(name)
+	if decl == nil {
+		return fmt.Errorf("%s is not in %s", name, d.file.Name)
+	}
+	var node Stmt = decl
+	groups := enclosingGroups(d.file.Stmts, decl)
+	for i := len(groups) - 1; i >= 0 && len(groups[i].Body) == 1; i-- {
+		node = groups[i]
+	}
+	start, end := d.lineStart(node.Pos().Offset), d.lineEnd(node.End().Offset)
+	if _, ok := node.(*GroupDecl); ok && start > 1 && d.src[start-1] == '\n' && d.src[start-2] == '\n' {
+		start--
+	}
+	return d.replace(start, end, "")
+}
+
+// enclosingGroups returns the group blocks containing decl, outermost first.
+func enclosingGroups(stmts []Stmt, decl *GomDecl) []*GroupDecl {
+	for _, stmt := range stmts {
+		group, ok := stmt.(*GroupDecl)
+		if !ok {
+			continue
+		}
+		for _, s := range group.Body {
+			if s == Stmt(decl) {
+				return []*GroupDecl{group}
+			}
+		}
+		if inner := enclosingGroups(group.Body, decl); inner != nil {
+			return append([]*GroupDecl{group}, inner...)
+		}
+	}
+	return nil
+}
+
+func sameGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// appendLines appends s at the end of the document, on a line of its own.
+func (d *Document) appendLines(s string) error {
+	at := len(d.src)
+	if at > 0 && d.src[at-1] != '\n' {
+		s = "\n" + s
+	}
+	return d.replace(at, at, s)
+}
+
+// lineStart returns the offset of the beginning of the line containing off.
+func (d *Document) lineStart(off int) int {
+	return bytes.LastIndexByte(d.src[:off], '\n') + 1
+}
+
+// lineEnd returns the offset of the beginning of the line following off.
+func (d *Document) lineEnd(off int) int {
+	if i := bytes.IndexByte(d.src[off:], '\n'); i >= 0 {
+		return off + i + 1
+	}
+	return len(d.src)
+}
+
+// lineIndent returns the leading whitespace of the line containing off.
+func (d *Document) lineIndent(off int) string {
+	start := d.lineStart(off)
+	end := start
+	for end < len(d.src) && (d.src[end] == ' ' || d.src[end] == '\t') {
+		end++
+	}
+	return string(d.src[start:end])
+}
+
+// replace substitutes text for src[start:end] and parses the result again so
+// that the syntax tree matches the new content.
+func (d *Document) replace(start, end int, text string) error {
+	src := make([]byte, 0, len(d.src)-(end-start)+len(text))
+	src = append(src, d.src[:start]...)
+	src = append(src, text...)
+	src = append(src, d.src[end:]...)
+	file, err := parseGomfileSource(d.file.Name, src)
+	if err != nil {
+		return err
+	}
+	d.src, d.file = src, file
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+const documentSource = `# Our dependencies
+gom 'github.com/mattn/go-runewidth', :tag => 'go1' # keep go1
+gom 'github.com/mattn/go-scan',
+    :commit => 'ecb144fb'
+
+group :test do
+    # test helpers
+    gom 'github.com/mattn/go-sqlite3'
+end
+`
+
+func TestDocumentRoundTrip(t *testing.T) {
+	doc, err := newDocument("Gomfile", []byte(documentSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(doc.Bytes()) != documentSource {
+		t.Fatalf("Expected %q, but %q:", documentSource, doc.Bytes())
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	doc, err := newDocument("Gomfile", []byte(documentSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return doc.SetOption("github.com/mattn/go-runewidth", "tag", "go1.1") },
+		func() error { return doc.SetOption("github.com/mattn/go-scan", "goos", []string{"linux", "darwin"}) },
+		func() error {
+			return doc.Add(Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"commit": "abcdef"}}, nil)
+		},
+		func() error {
+			return doc.Add(Gom{name: "github.com/mattn/go-colorable", options: map[string]interface{}{}}, []string{"test"})
+		},
+		func() error {
+			return doc.Add(Gom{name: "github.com/mattn/go-ole", options: map[string]interface{}{}}, []string{"production"})
+		},
+		func() error { return doc.Remove("github.com/mattn/go-sqlite3") },
+		func() error { return doc.RemoveOption("github.com/mattn/go-gtk", "commit") },
+		func() error {
+			return doc.Add(Gom{name: "github.com/mattn/go-isatty", options: map[string]interface{}{}}, []string{"development"})
+		},
+		func() error { return doc.Remove("github.com/mattn/go-isatty") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `# Our dependencies
+gom 'github.com/mattn/go-runewidth', :tag => 'go1.1' # keep go1
+gom 'github.com/mattn/go-scan',
+    :commit => 'ecb144fb', :goos => [:linux, :darwin]
+gom 'github.com/mattn/go-gtk'
+
+group :test do
+    # test helpers
+    gom 'github.com/mattn/go-colorable'
+end
+
+group :production do
+  gom 'github.com/mattn/go-ole'
+end
+`
+	if string(doc.Bytes()) != expected {
+		t.Fatalf("Expected %q, but %q:", expected, doc.Bytes())
+	}
+
+	if err := doc.Add(Gom{name: "github.com/mattn/go-ole", options: map[string]interface{}{}}, nil); err == nil {
+		t.Fatal("Expected an error when adding a package twice")
+	}
+}
+
+func TestGomfileEntry(t *testing.T) {
+	g := Gom{name: "github.com/mattn/go-ole", options: map[string]interface{}{
+		"goos":    []string{"windows"},
+		"tag":     "it's",
+		"commit":  "abcdef",
+		"private": "true",
+	}}
+	expected := `gom 'github.com/mattn/go-ole', :commit => 'abcdef', :private => 'true', :tag => 'it\'s', :goos => [:windows]`
+	if g.GomfileEntry() != expected {
+		t.Fatalf("Expected %q, but %q:", expected, g.GomfileEntry())
+	}
+}
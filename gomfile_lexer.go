@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in a Gomfile. Offset is the byte offset from the start of
+// the file, Line and Col are 1-based.
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokComment
+	tokIdent
+	tokString
+	tokSymbol
+	tokArrow
+	tokComma
+	tokLBrack
+	tokRBrack
+	tokIllegal
+)
+
+type token struct {
+	kind tokenKind
+	pos  Pos
+	raw  string // exact source text of the token
+	val  string // unquoted value for strings and symbols, message for illegal tokens
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokNewline:
+		return "newline"
+	case tokComment:
+		return "comment"
+	case tokString:
+		return "string " + t.raw
+	case tokSymbol:
+		return "symbol " + t.raw
+	case tokIllegal:
+		return t.val
+	}
+	return fmt.Sprintf("%q", t.raw)
+}
+
+type lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1, col: 1}
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{Offset: l.off, Line: l.line, Col: l.col}
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+func (l *lexer) advance() {
+	if l.src[l.off] == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	l.off++
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || '0' <= c && c <= '9'
+}
+
+// next returns the next token. Lexical errors are reported as tokIllegal
+// tokens and left for the parser to turn into a SyntaxError.
+func (l *lexer) next() token {
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		if c != ' ' && c != '\t' && c != '\r' {
+			break
+		}
+		l.advance()
+	}
+	start := l.pos()
+	if l.off >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	tok := token{pos: start}
+	c := l.src[l.off]
+	switch {
+	case c == '\n':
+		l.advance()
+		tok.kind = tokNewline
+	case c == '#':
+		for l.off < len(l.src) && l.src[l.off] != '\n' {
+			l.advance()
+		}
+		tok.kind = tokComment
+	case c == ',':
+		l.advance()
+		tok.kind = tokComma
+	case c == '[':
+		l.advance()
+		tok.kind = tokLBrack
+	case c == ']':
+		l.advance()
+		tok.kind = tokRBrack
+	case c == '=' && l.peek(1) == '>':
+		l.advance()
+		l.advance()
+		tok.kind = tokArrow
+	case c == ':' && isIdentStart(l.peek(1)):
+		l.advance()
+		for l.off < len(l.src) && isIdentChar(l.src[l.off]) {
+			l.advance()
+		}
+		tok.kind = tokSymbol
+		tok.val = l.src[start.Offset+1 : l.off]
+	case c == '\'' || c == '"':
+		val, ok := l.scanString(c)
+		if !ok {
+			tok.kind = tokIllegal
+			tok.raw = l.src[start.Offset:l.off]
+			tok.val = "unterminated string"
+			return tok
+		}
+		tok.kind = tokString
+		tok.val = val
+	case isIdentStart(c):
+		for l.off < len(l.src) && isIdentChar(l.src[l.off]) {
+			l.advance()
+		}
+		tok.kind = tokIdent
+		tok.val = l.src[start.Offset:l.off]
+	default:
+		l.advance()
+		tok.kind = tokIllegal
+		tok.raw = l.src[start.Offset:l.off]
+		tok.val = fmt.Sprintf("illegal character %q", c)
+		return tok
+	}
+	tok.raw = l.src[start.Offset:l.off]
+	return tok
+}
+
+// scanString scans a quoted string following Ruby's rules: single-quoted
+// strings only know the \' and \\ escapes, double-quoted strings also
+// understand the usual control character escapes.
+func (l *lexer) scanString(quote byte) (string, bool) {
+	var b strings.Builder
+	l.advance()
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		switch {
+		case c == quote:
+			l.advance()
+			return b.String(), true
+		case c == '\n':
+			return "", false
+		case c == '\\' && l.off+1 < len(l.src):
+			e := l.src[l.off+1]
+			l.advance()
+			l.advance()
+			if quote == '\'' {
+				if e != '\'' && e != '\\' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(e)
+				continue
+			}
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+			l.advance()
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,407 @@
+package main
+
+import "fmt"
+
+// Node is an element of a parsed Gomfile. Pos is the position of the first
+// character of the node and End the position right after its last one.
+type Node interface {
+	Pos() Pos
+	End() Pos
+}
+
+// Stmt is a top level or group level statement of a Gomfile.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Value is the right hand side of an option.
+type Value interface {
+	Node
+	valueNode()
+}
+
+// Comment is a "#" comment, running until the end of the line.
+type Comment struct {
+	Hash Pos
+	Text string // including the leading "#"
+}
+
+// Literal is a string, symbol or bare word such as true.
+type Literal struct {
+	ValuePos Pos
+	Kind     tokenKind
+	Raw      string // as written in the source
+	Value    string // unquoted value, without the ':' for symbols
+}
+
+// List is a bracketed list of literals.
+type List struct {
+	Lbrack Pos
+	Items  []*Literal
+	Rbrack Pos
+}
+
+// Option is a `:key => value` pair of a gom declaration.
+type Option struct {
+	Key   *Literal
+	Value Value
+}
+
+// GomDecl is a `gom 'import/path', :key => value, ...` declaration.
+type GomDecl struct {
+	GomPos  Pos
+	Name    *Literal
+	Options []*Option
+	Comment *Comment // trailing comment, if any
+}
+
+// GroupDecl is a `group :a, :b do ... end` block.
+type GroupDecl struct {
+	GroupPos   Pos
+	Names      []*Literal
+	Comment    *Comment // trailing comment after "do", if any
+	Body       []Stmt
+	EndPos     Pos
+	EndComment *Comment // trailing comment after "end", if any
+}
+
+// CommentStmt is a comment standing on its own line.
+type CommentStmt struct {
+	Comment *Comment
+}
+
+// File is a parsed Gomfile.
+type File struct {
+	Name  string
+	Stmts []Stmt
+}
+
+func (c *Comment) Pos() Pos { return c.Hash }
+func (c *Comment) End() Pos { return advancePos(c.Hash, c.Text) }
+
+func (x *Literal) Pos() Pos { return x.ValuePos }
+func (x *Literal) End() Pos { return advancePos(x.ValuePos, x.Raw) }
+
+func (x *List) Pos() Pos { return x.Lbrack }
+func (x *List) End() Pos { return advancePos(x.Rbrack, "]") }
+
+func (o *Option) Pos() Pos { return o.Key.Pos() }
+func (o *Option) End() Pos { return o.Value.End() }
+
+func (d *GomDecl) Pos() Pos { return d.GomPos }
+func (d *GomDecl) End() Pos {
+	if d.Comment != nil {
+		return d.Comment.End()
+	}
+	if n := len(d.Options); n > 0 {
+		return d.Options[n-1].End()
+	}
+	return d.Name.End()
+}
+
+func (d *GroupDecl) Pos() Pos { return d.GroupPos }
+func (d *GroupDecl) End() Pos {
+	if d.EndComment != nil {
+		return d.EndComment.End()
+	}
+	return advancePos(d.EndPos, "end")
+}
+
+func (s *CommentStmt) Pos() Pos { return s.Comment.Pos() }
+func (s *CommentStmt) End() Pos { return s.Comment.End() }
+
+func (*Literal) valueNode() {}
+func (*List) valueNode()    {}
+
+func (*GomDecl) stmtNode()     {}
+func (*GroupDecl) stmtNode()   {}
+func (*CommentStmt) stmtNode() {}
+
+// advancePos returns the position right after s when s starts at p.
+func advancePos(p Pos, s string) Pos {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			p.Line++
+			p.Col = 1
+		} else {
+			p.Col++
+		}
+	}
+	p.Offset += len(s)
+	return p
+}
+
+// optionValue converts v to the representation used by Gom.options: a string
+// for literals and a []string for lists.
+func optionValue(v Value) interface{} {
+	switch v := v.(type) {
+	case *Literal:
+		return v.Value
+	case *List:
+		a := []string{}
+		for _, item := range v.Items {
+			a = append(a, item.Value)
+		}
+		return a
+	}
+	return nil
+}
+
+// SyntaxError describes a Gomfile parse failure.
+type SyntaxError struct {
+	Filename string
+	Pos      Pos
+	Found    string // description of the offending token
+	Expected string // what the parser was looking for
+}
+
+func (e *SyntaxError) Error() string {
+	name := e.Filename
+	if name == "" {
+		name = "Gomfile"
+	}
+	if e.Expected == "" {
+		return fmt.Sprintf("%s:%s: syntax error: %s", name, e.Pos, e.Found)
+	}
+	return fmt.Sprintf("%s:%s: syntax error: unexpected %s, expected %s", name, e.Pos, e.Found, e.Expected)
+}
+
+type parser struct {
+	filename string
+	lex      *lexer
+	tok      token
+}
+
+// parseGomfileSource parses the content of a Gomfile into its syntax tree.
+func parseGomfileSource(filename string, src []byte) (*File, error) {
+	p := &parser{filename: filename, lex: newLexer(string(src))}
+	p.next()
+	file := &File{Name: filename}
+	for p.tok.kind != tokEOF {
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			file.Stmts = append(file.Stmts, stmt)
+		}
+	}
+	return file, nil
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(expected string) error {
+	found := p.tok.String()
+	if p.tok.kind == tokIllegal {
+		// The lexer message already says what is wrong.
+		return &SyntaxError{Filename: p.filename, Pos: p.tok.pos, Found: found}
+	}
+	return &SyntaxError{Filename: p.filename, Pos: p.tok.pos, Found: found, Expected: expected}
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	return p.tok.kind == tokIdent && p.tok.val == kw
+}
+
+// skipNewlines skips the newlines allowed after a comma or an opening bracket.
+// Comments found in between are dropped from the tree.
+func (p *parser) skipNewlines() {
+	for p.tok.kind == tokNewline || p.tok.kind == tokComment {
+		p.next()
+	}
+}
+
+// parseStmt returns nil for blank lines.
+func (p *parser) parseStmt() (Stmt, error) {
+	switch {
+	case p.tok.kind == tokNewline:
+		p.next()
+		return nil, nil
+	case p.tok.kind == tokComment:
+		c := p.parseComment()
+		if err := p.expectEOL(); err != nil {
+			return nil, err
+		}
+		return &CommentStmt{Comment: c}, nil
+	case p.isKeyword("gom"):
+		return p.parseGom()
+	case p.isKeyword("group"):
+		return p.parseGroup()
+	}
+	return nil, p.errorf(`"gom", "group" or comment`)
+}
+
+func (p *parser) parseComment() *Comment {
+	c := &Comment{Hash: p.tok.pos, Text: p.tok.raw}
+	p.next()
+	return c
+}
+
+// parseTrailingComment parses an optional comment and the end of line that
+// must follow a statement.
+func (p *parser) parseTrailingComment() (*Comment, error) {
+	var c *Comment
+	if p.tok.kind == tokComment {
+		c = p.parseComment()
+	}
+	return c, p.expectEOL()
+}
+
+func (p *parser) expectEOL() error {
+	switch p.tok.kind {
+	case tokNewline:
+		p.next()
+		return nil
+	case tokEOF:
+		return nil
+	}
+	return p.errorf("end of line")
+}
+
+func (p *parser) parseLiteral() *Literal {
+	x := &Literal{ValuePos: p.tok.pos, Kind: p.tok.kind, Raw: p.tok.raw, Value: p.tok.val}
+	p.next()
+	return x
+}
+
+func (p *parser) parseGom() (Stmt, error) {
+	d := &GomDecl{GomPos: p.tok.pos}
+	p.next()
+	if p.tok.kind != tokString {
+		return nil, p.errorf("quoted package name")
+	}
+	d.Name = p.parseLiteral()
+	for p.tok.kind == tokComma {
+		p.next()
+		p.skipNewlines()
+		opt, err := p.parseOption()
+		if err != nil {
+			return nil, err
+		}
+		d.Options = append(d.Options, opt)
+	}
+	if p.tok.kind != tokComment && p.tok.kind != tokNewline && p.tok.kind != tokEOF {
+		return nil, p.errorf(`"," or end of line`)
+	}
+	c, err := p.parseTrailingComment()
+	if err != nil {
+		return nil, err
+	}
+	d.Comment = c
+	return d, nil
+}
+
+func (p *parser) parseOption() (*Option, error) {
+	if p.tok.kind != tokSymbol {
+		return nil, p.errorf("option name like :tag")
+	}
+	opt := &Option{Key: p.parseLiteral()}
+	if p.tok.kind != tokArrow {
+		return nil, p.errorf(`"=>"`)
+	}
+	p.next()
+	switch {
+	case p.tok.kind == tokString, p.tok.kind == tokSymbol, p.tok.kind == tokIdent:
+		opt.Value = p.parseLiteral()
+	case p.tok.kind == tokLBrack:
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		opt.Value = list
+	default:
+		return nil, p.errorf("option value")
+	}
+	return opt, nil
+}
+
+func (p *parser) parseList() (*List, error) {
+	list := &List{Lbrack: p.tok.pos}
+	p.next()
+	p.skipNewlines()
+	for p.tok.kind != tokRBrack {
+		if p.tok.kind != tokSymbol && p.tok.kind != tokString {
+			return nil, p.errorf(`symbol, string or "]"`)
+		}
+		list.Items = append(list.Items, p.parseLiteral())
+		p.skipNewlines()
+		if p.tok.kind == tokRBrack {
+			break
+		}
+		if p.tok.kind != tokComma {
+			return nil, p.errorf(`"," or "]"`)
+		}
+		p.next()
+		p.skipNewlines()
+	}
+	list.Rbrack = p.tok.pos
+	p.next()
+	return list, nil
+}
+
+func (p *parser) parseGroup() (Stmt, error) {
+	d := &GroupDecl{GroupPos: p.tok.pos}
+	p.next()
+	for {
+		if p.tok.kind != tokSymbol && p.tok.kind != tokString {
+			return nil, p.errorf("group name like :test")
+		}
+		d.Names = append(d.Names, p.parseLiteral())
+		if p.tok.kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if !p.isKeyword("do") {
+		return nil, p.errorf(`"," or "do"`)
+	}
+	p.next()
+	c, err := p.parseTrailingComment()
+	if err != nil {
+		return nil, err
+	}
+	d.Comment = c
+
+	for !p.isKeyword("end") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf(fmt.Sprintf(`"end" closing the group at line %d`, d.GroupPos.Line))
+		}
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			d.Body = append(d.Body, stmt)
+		}
+	}
+	d.EndPos = p.tok.pos
+	p.next()
+	c, err = p.parseTrailingComment()
+	if err != nil {
+		return nil, err
+	}
+	d.EndComment = c
+	return d, nil
+}
+
+// groupNames returns the names of the groups declared by d.
+func (d *GroupDecl) groupNames() []string {
+	names := make([]string, 0, len(d.Names))
+	for _, n := range d.Names {
+		names = append(names, n.Value)
+	}
+	return names
+}
+
+// options converts the options of d to the map used by Gom.
+func (d *GomDecl) options() map[string]interface{} {
+	options := make(map[string]interface{})
+	for _, opt := range d.Options {
+		options[opt.Key.Value] = optionValue(opt.Value)
+	}
+	return options
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGomfileSource(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []Gom
+	}{
+		{
+			src:      `gom 'github.com/mattn/go-gtk' # trailing comment`,
+			expected: []Gom{{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}},
+		},
+		{
+			src: `gom 'github.com/mattn/it\'s', :command => "git clone \"http://example.com/repo.git\""`,
+			expected: []Gom{{name: "github.com/mattn/it's", options: map[string]interface{}{
+				"command": `git clone "http://example.com/repo.git"`,
+			}}},
+		},
+		{
+			src: `
+gom 'github.com/mattn/go-ole',
+    :goos => [
+        :windows,
+        :linux, # not on darwin
+    ],
+    :tag => 'v1'
+`,
+			expected: []Gom{{name: "github.com/mattn/go-ole", options: map[string]interface{}{
+				"goos": []string{"windows", "linux"},
+				"tag":  "v1",
+			}}},
+		},
+		{
+			src: `
+# comment
+group :test do # test only
+  gom 'github.com/mattn/go-sqlite3', :private => true
+end # test
+`,
+			expected: []Gom{{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"private": "true"}}},
+		},
+	}
+
+	*testEnv = true
+	defer func() { *testEnv = false }()
+	for _, test := range tests {
+		file, err := parseGomfileSource("Gomfile", []byte(test.src))
+		if err != nil {
+			t.Fatalf("%q: %v", test.src, err)
+		}
+		goms := selectGoms(file.Stmts, nil)
+		if !reflect.DeepEqual(goms, test.expected) {
+			t.Fatalf("Expected %v, but %v:", test.expected, goms)
+		}
+	}
+}
+
+func TestParseGomfileSourceErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			src:      "gom github.com/mattn/go-gtk",
+			expected: "Gomfile:1:5: syntax error: unexpected \"github\", expected quoted package name",
+		},
+		{
+			src:      "\ngom 'github.com/mattn/go-gtk' :tag => 'v1'",
+			expected: "Gomfile:2:31: syntax error: unexpected symbol :tag, expected \",\" or end of line",
+		},
+		{
+			src:      "gom 'github.com/mattn/go-gtk', :tag 'v1'",
+			expected: "Gomfile:1:37: syntax error: unexpected string 'v1', expected \"=>\"",
+		},
+		{
+			src:      "gom 'github.com/mattn/go-gtk', :tag => 'v1",
+			expected: "Gomfile:1:40: syntax error: unterminated string",
+		},
+		{
+			src:      "group :test do\n  gom 'github.com/mattn/go-gtk'\n",
+			expected: "Gomfile:3:1: syntax error: unexpected end of file, expected \"end\" closing the group at line 1",
+		},
+		{
+			src:      "end",
+			expected: "Gomfile:1:1: syntax error: unexpected \"end\", expected \"gom\", \"group\" or comment",
+		},
+		{
+			src:      "gom 'a', :goos => [:linux :windows]",
+			expected: "Gomfile:1:27: syntax error: unexpected symbol :windows, expected \",\" or \"]\"",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseGomfileSource("Gomfile", []byte(test.src))
+		if err == nil {
+			t.Fatalf("%q: expected an error", test.src)
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("Expected %q, but %q:", test.expected, err.Error())
+		}
+	}
+}
@@ -4,86 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
-type vcsCmd struct {
-	checkout     []string
-	update       []string
-	revision     []string
-	revisionMask string
-}
-
-var (
-	hg = &vcsCmd{
-		[]string{"hg", "update"},
-		[]string{"hg", "pull"},
-		[]string{"hg", "id", "-i"},
-		"^(.+)$",
-	}
-	git = &vcsCmd{
-		[]string{"git", "checkout", "-q"},
-		[]string{"git", "fetch"},
-		[]string{"git", "rev-parse", "HEAD"},
-		"^(.+)$",
-	}
-	bzr = &vcsCmd{
-		[]string{"bzr", "revert", "-r"},
-		[]string{"bzr", "pull"},
-		[]string{"bzr", "log", "-r-1", "--line"},
-		"^([0-9]+)",
-	}
-)
-
-func (vcs *vcsCmd) Checkout(p, destination string) error {
-	args := append(vcs.checkout, destination)
-	return vcsExec(p, args...)
-}
-
-func (vcs *vcsCmd) Update(p string) error {
-	return vcsExec(p, vcs.update...)
-}
-
-func (vcs *vcsCmd) Revision(dir string) (string, error) {
-	args := append(vcs.revision)
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Dir = dir
-	cmd.Stderr = os.Stderr
-	b, err := cmd.Output()
-	if err != nil {
-		println(err.Error())
-		return "", err
-	}
-	rev := strings.TrimSpace(string(b))
-	if vcs.revisionMask != "" {
-		return regexp.MustCompile(vcs.revisionMask).FindString(rev), nil
-	}
-	return rev, nil
-}
-
-func (vcs *vcsCmd) Sync(p, destination string) error {
-	err := vcs.Checkout(p, destination)
-	if err != nil {
-		err = vcs.Update(p)
-		if err != nil {
-			return err
-		}
-		err = vcs.Checkout(p, destination)
-	}
-	return err
-}
-
-func vcsExec(dir string, args ...string) error {
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func has(c interface{}, key string) bool {
 	if m, ok := c.(map[string]interface{}); ok {
 		_, ok := m[key]
@@ -98,7 +22,9 @@ func has(c interface{}, key string) bool {
 	return false
 }
 
-func (gom *Gom) Clone(args []string) error {
+// Clone fetches the repository of gom in the vendor directory, from the
+// cache when possible. Its dependencies are fetched by fetchImports.
+func (gom *Gom) Clone(r *runner) error {
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
@@ -113,8 +39,8 @@ func (gom *Gom) Clone(args []string) error {
 		customCmd := strings.Split(command, " ")
 		customCmd = append(customCmd, srcdir)
 
-		fmt.Printf("fetching %s (%v)\n", gom.name, customCmd)
-		err = run(customCmd, Blue)
+		r.printf("fetching %s (%v)\n", gom.name, customCmd)
+		err = r.run("", Blue, customCmd...)
 		if err != nil {
 			return err
 		}
@@ -127,11 +53,11 @@ func (gom *Gom) Clone(args []string) error {
 			srcdir := filepath.Join(vendor, "src", target)
 			if _, err := os.Stat(srcdir); err != nil {
 				if os.IsExist(err) {
-					if err := gom.pullPrivate(srcdir); err != nil {
+					if err := gom.pullPrivate(r, srcdir); err != nil {
 						return err
 					}
 				} else {
-					if err := gom.clonePrivate(srcdir); err != nil {
+					if err := gom.clonePrivate(r, srcdir); err != nil {
 						return err
 					}
 				}
@@ -139,20 +65,36 @@ func (gom *Gom) Clone(args []string) error {
 		}
 	}
 
-	cmdArgs := []string{"go", "get", "-d"}
-	cmdArgs = append(cmdArgs, args...)
-	cmdArgs = append(cmdArgs, gom.name)
+	if gom.fetchedItself() {
+		return nil
+	}
+	err = gom.followURL(r, vendor)
+	if err != nil {
+		return err
+	}
+	cached, err := gom.cloneFromCache(r, vendor)
+	if err != nil || cached {
+		return err
+	}
+	if offline {
+		return fmt.Errorf("%s is not in the cache", gom.name)
+	}
+	return gom.cloneDirect(r, vendor)
+}
 
-	fmt.Printf("downloading %s\n", gom.name)
-	return run(cmdArgs, Blue)
+// fetchedItself tells whether gom is fetched by its :command or as a
+// private repository, rather than from its repository URL.
+func (gom *Gom) fetchedItself() bool {
+	private, _ := gom.options["private"].(string)
+	return has(gom.options, "command") || private == "true"
 }
 
-func (gom *Gom) pullPrivate(srcdir string) (err error) {
-	fmt.Printf("fetching private repo %s\n", gom.name)
+func (gom *Gom) pullPrivate(r *runner, srcdir string) (err error) {
+	r.printf("fetching private repo %s\n", gom.name)
 	pullCmd := fmt.Sprintf("git --work-tree=%s, --git-dir=%s/.git pull origin",
 		srcdir, srcdir)
 	pullArgs := strings.Split(pullCmd, " ")
-	err = run(pullArgs, Blue)
+	err = r.run("", Blue, pullArgs...)
 	if err != nil {
 		return
 	}
@@ -160,13 +102,13 @@ func (gom *Gom) pullPrivate(srcdir string) (err error) {
 	return
 }
 
-func (gom *Gom) clonePrivate(srcdir string) (err error) {
+func (gom *Gom) clonePrivate(r *runner, srcdir string) (err error) {
 	name := strings.Split(gom.name, "/")
 	privateUrl := fmt.Sprintf("git@%s:%s/%s", name[0], name[1], name[2])
 
-	fmt.Printf("fetching private repo %s\n", gom.name)
+	r.printf("fetching private repo %s\n", gom.name)
 	cloneCmd := []string{"git", "clone", privateUrl, srcdir}
-	err = run(cloneCmd, Blue)
+	err = r.run("", Blue, cloneCmd...)
 	if err != nil {
 		return
 	}
@@ -174,7 +116,7 @@ func (gom *Gom) clonePrivate(srcdir string) (err error) {
 	return
 }
 
-func (gom *Gom) Checkout() error {
+func (gom *Gom) Checkout(r *runner) error {
 	commit_or_branch_or_tag := ""
 	if has(gom.options, "branch") {
 		commit_or_branch_or_tag, _ = gom.options["branch"].(string)
@@ -194,32 +136,57 @@ func (gom *Gom) Checkout() error {
 	}
 	p := filepath.Join(vendor, "src")
 	for _, elem := range strings.Split(gom.name, "/") {
-		var vcs *vcsCmd
 		p = filepath.Join(p, elem)
-		if isDir(filepath.Join(p, ".git")) {
-			vcs = git
-		} else if isDir(filepath.Join(p, ".hg")) {
-			vcs = hg
-		} else if isDir(filepath.Join(p, ".bzr")) {
-			vcs = bzr
+		// Commands run at the root of the checkout, as svn only updates
+		// the directory it runs in.
+		if vcs := vcsAt(p); vcs != nil {
+			if tag, ok := gom.options["tag"].(string); ok && isVersionConstraint(tag) && !has(gom.options, "commit") {
+				commit_or_branch_or_tag, err = gom.resolveTag(r, vcs, p, tag)
+				if err != nil {
+					return err
+				}
+			}
+			return syncCheckout(r, vcs, p, commit_or_branch_or_tag)
+		}
+	}
+	r.printf("Warning: don't know how to checkout for %v\n", gom.name)
+	return errors.New("gom currently support git/hg/bzr/svn/fossil for specifying tag/branch/commit")
+}
+
+// resolveTag returns the highest tag of the repository in p satisfying the
+// version constraints, updating the repository if no known tag does.
+func (gom *Gom) resolveTag(r *runner, vcs VCS, p, constraints string) (string, error) {
+	for updated := false; ; updated = true {
+		tags, err := vcs.ListTags(p)
+		if err != nil {
+			return "", err
+		}
+		tag, err := resolveVersion(constraints, tags)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", gom.name, err)
+		}
+		if tag != "" {
+			r.printf("using %s %s for %s\n", gom.name, tag, constraints)
+			return tag, nil
 		}
-		if vcs != nil {
-			p = filepath.Join(vendor, "src", gom.name)
-			return vcs.Sync(p, commit_or_branch_or_tag)
+		if updated {
+			return "", fmt.Errorf("%s: no tag matches %s", gom.name, constraints)
+		}
+		err = vcs.Fetch(r, p)
+		if err != nil {
+			return "", err
 		}
 	}
-	fmt.Printf("Warning: don't know how to checkout for %v\n", gom.name)
-	return errors.New("gom currently support git/hg/bzr for specifying tag/branch/commit")
 }
 
-func (gom *Gom) Build(args []string) error {
+func (gom *Gom) Build(r *runner, args []string) error {
 	installCmd := append([]string{"go", "install"}, args...)
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
 	}
 	p := filepath.Join(vendor, "src", gom.name)
-	return vcsExec(p, installCmd...)
+	return r.run(p, None, installCmd...)
 }
 
 func isFile(p string) bool {
@@ -236,32 +203,138 @@ func isDir(p string) bool {
 	return false
 }
 
+// prepareVendor creates the vendor directory if needed and points GOPATH and
+// GOBIN to it.
+func prepareVendor() error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(vendor)
+	if err != nil {
+		err = os.MkdirAll(vendor, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Setenv("GOPATH", vendor)
+	if err != nil {
+		return err
+	}
+	return os.Setenv("GOBIN", filepath.Join(vendor, "bin"))
+}
+
+// installOptions holds the flags handled by `gom install` itself. The other
+// arguments are passed to go install.
+type installOptions struct {
+	frozen  bool
+	force   bool
+	offline bool
+	// from is a bundle to install the packages from.
+	from string
+}
+
+func parseInstallArgs(args []string) (installOptions, []string, error) {
+	var opts installOptions
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-frozen" || arg == "--frozen":
+			opts.frozen = true
+		case arg == "-force" || arg == "--force":
+			opts.force = true
+		case arg == "-offline" || arg == "--offline":
+			opts.offline = true
+		case arg == "-from" || arg == "--from":
+			if i+1 == len(args) {
+				return opts, nil, fmt.Errorf("%s needs a bundle", arg)
+			}
+			i++
+			opts.from = args[i]
+		case strings.HasPrefix(arg, "-from=") || strings.HasPrefix(arg, "--from="):
+			opts.from = arg[strings.Index(arg, "=")+1:]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return opts, rest, nil
+}
+
 func install(args []string) error {
+	opts, args, err := parseInstallArgs(args)
+	if err != nil {
+		return err
+	}
+	offline = opts.offline
+	if opts.frozen {
+		err := checkFrozen("Gomfile")
+		if err != nil {
+			return err
+		}
+	}
+
 	allGoms, err := parseGomfile("Gomfile")
 	if err != nil {
 		return err
 	}
-	vendor, err := filepath.Abs(vendorFolder)
+	if isFile("Gomfile.lock") {
+		rememberLockfile("Gomfile.lock")
+	}
+	err = prepareVendor()
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(vendor)
+
+	err = ready()
 	if err != nil {
-		err = os.MkdirAll(vendor, 0755)
+		return err
+	}
+	goms := installableGoms(allGoms)
+	if opts.from != "" {
+		err = installBundle(opts.from, goms)
 		if err != nil {
 			return err
 		}
+		return buildGoms(goms, args)
 	}
-	err = os.Setenv("GOPATH", vendor)
+	if opts.force {
+		return installGoms(goms, args)
+	}
+	rest, err := skipInstalled(goms)
 	if err != nil {
 		return err
 	}
-	err = os.Setenv("GOBIN", filepath.Join(vendor, "bin"))
+	err = fetchGoms(rest)
 	if err != nil {
 		return err
 	}
+	// The packages up to date are built too: their last build may have
+	// failed, and go install has nothing to do for the others.
+	return buildGoms(goms, args)
+}
+
+// skipInstalled leaves out the packages already installed at their pinned
+// revision, with their pinned checksum if any, and clean.
+func skipInstalled(goms []Gom) ([]Gom, error) {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return nil, err
+	}
+	rest := make([]Gom, 0)
+	for _, gom := range goms {
+		if checkReport(vendor, gom).Status == statusOK {
+			fmt.Printf("%s is up to date\n", gom.name)
+			continue
+		}
+		rest = append(rest, gom)
+	}
+	return rest, nil
+}
 
-	// 1. Filter goms to install
+// installableGoms filters the packages to install in the current group and
+// OS.
+func installableGoms(allGoms []Gom) []Gom {
 	goms := make([]Gom, 0)
 	for _, gom := range allGoms {
 		if group, ok := gom.options["group"]; ok {
@@ -276,30 +349,77 @@ func install(args []string) error {
 		}
 		goms = append(goms, gom)
 	}
+	return goms
+}
 
-	// 2. Clone the repositories
-	for _, gom := range goms {
-		err = gom.Clone(args)
-		if err != nil {
-			return err
-		}
+// installGoms fetches, checks out and builds goms in the vendor directory.
+func installGoms(goms []Gom, args []string) error {
+	err := fetchGoms(goms)
+	if err != nil {
+		return err
 	}
+	return buildGoms(goms, args)
+}
 
-	// 3. Checkout the commit/branch/tag if needed
-	for _, gom := range goms {
-		err = gom.Checkout()
-		if err != nil {
-			return err
-		}
+// fetchGoms clones goms in the vendor directory, checks out their
+// commit/branch/tag and fetches the packages they import.
+func fetchGoms(goms []Gom) error {
+	// 1. Clone the repositories
+	err := forEachGom(goms, func(r *runner, gom *Gom) error {
+		defer lockRepository(gom)()
+		return gom.Clone(r)
+	})
+	if err != nil {
+		return err
 	}
 
-	// 4. Build and install
-	for _, gom := range goms {
-		err = gom.Build(args)
+	// 2. Checkout the commit/branch/tag if needed
+	err = forEachGom(goms, func(r *runner, gom *Gom) error {
+		defer lockRepository(gom)()
+		return gom.Checkout(r)
+	})
+	if err != nil {
+		return err
+	}
+
+	// 3. Fetch the imports missing from the Gomfile
+	return fetchImports(goms)
+}
+
+// fetchImports fetches the packages goms import which are not in the vendor
+// directory, at the head of their default branch as `go get -d` does, and
+// the ones these import in turn. It fails listing the imports still missing
+// once their repository is fetched.
+func fetchImports(goms []Gom) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	fetched := make(map[string]bool)
+	for {
+		deps := make([]Gom, 0)
+		unfetchable := []string{}
+		for _, imp := range missingImports(vendor, goms) {
+			if fetched[imp] {
+				unfetchable = append(unfetchable, imp)
+				continue
+			}
+			fetched[imp] = true
+			fmt.Printf("%s is not in the Gomfile, fetching it unpinned\n", imp)
+			deps = append(deps, Gom{name: imp, options: make(map[string]interface{})})
+		}
+		if len(unfetchable) > 0 {
+			return fmt.Errorf("imported packages not found: %s", strings.Join(unfetchable, ", "))
+		}
+		if len(deps) == 0 {
+			return nil
+		}
+		err = forEachGom(deps, func(r *runner, gom *Gom) error {
+			defer lockRepository(gom)()
+			return gom.Clone(r)
+		})
 		if err != nil {
 			return err
 		}
 	}
-
-	return nil
 }
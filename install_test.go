@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInstallArgs(t *testing.T) {
+	opts, rest, err := parseInstallArgs([]string{"--frozen", "-v", "--force", "--from", "bundle.tgz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.frozen || !opts.force || opts.from != "bundle.tgz" {
+		t.Fatalf("Expected --frozen, --force and --from, but %+v:", opts)
+	}
+	if !reflect.DeepEqual(rest, []string{"-v"}) {
+		t.Fatalf("Expected %v, but %v:", []string{"-v"}, rest)
+	}
+	if _, _, err := parseInstallArgs([]string{"--from"}); err == nil {
+		t.Fatal("Expected an error for --from without a bundle")
+	}
+}
+
+func TestSkipInstalled(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	a := gitRepo(t, filepath.Join(dir, vendorFolder, "src", "example.com", "a"))
+	b := filepath.Join(dir, vendorFolder, "src", "example.com", "b")
+	gitRepo(t, b)
+	gitCmd(t, b, "commit", "-q", "--allow-empty", "-m", "second")
+
+	goms := []Gom{
+		{name: "example.com/a", options: map[string]interface{}{"commit": a}},
+		{name: "example.com/b", options: map[string]interface{}{"commit": a}},
+		{name: "example.com/c", options: map[string]interface{}{"commit": a}},
+		{name: "example.com/a/sub", options: map[string]interface{}{}},
+	}
+	rest, err := skipInstalled(goms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, gom := range rest {
+		names = append(names, gom.name)
+	}
+	expected := []string{"example.com/b", "example.com/c", "example.com/a/sub"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, names)
+	}
+}
+
+func TestCloneNotPrivate(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	origin := filepath.Join(dir, "origin")
+	rev := gitRepo(t, origin)
+	gom := Gom{name: "example.com/p", options: map[string]interface{}{"private": "false", "url": origin}}
+	if err := gom.Clone(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if installed := installedRevision(filepath.Join(dir, vendorFolder), gom.name); installed != rev {
+		t.Fatalf("Expected %v, but %v:", rev, installed)
+	}
+}
+
+func TestFetchImports(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldClient := httpClient
+	defer func() {
+		httpClient = oldClient
+	}()
+
+	a := filepath.Join(dir, "a")
+	gitRepo(t, a)
+	httpClient = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != "example.org" || !strings.HasPrefix(req.URL.Path, "/a") {
+			return nil, fmt.Errorf("unexpected request for %s", req.URL)
+		}
+		meta := `<html><head><meta name="go-import" content="example.org/a git ` + a + `"></head></html>`
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: ioutil.NopCloser(strings.NewReader(meta))}, nil
+	})}
+	top := filepath.Join(dir, "top")
+	gitRepo(t, top)
+	if err := ioutil.WriteFile(filepath.Join(top, "y.go"), []byte("package x\n\nimport _ \"example.org/a\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, top, "add", "y.go")
+	gitCmd(t, top, "commit", "-q", "-m", "import a")
+
+	goms := []Gom{{name: "example.com/top", options: map[string]interface{}{"url": top}}}
+	if err := fetchGoms(goms); err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(dir, vendorFolder, "src", "example.org", "a", "x.go")) {
+		t.Fatal("Expected example.org/a to be fetched")
+	}
+
+	// An import the fetched repository doesn't have is reported.
+	y := filepath.Join(dir, vendorFolder, "src", "example.com", "top", "y.go")
+	if err := ioutil.WriteFile(y, []byte("package x\n\nimport _ \"example.org/a/none\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := fetchImports(goms)
+	if err == nil || !strings.Contains(err.Error(), "example.org/a/none") {
+		t.Fatalf("Expected example.org/a/none not to be found, but %v:", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 )
 
@@ -13,19 +14,40 @@ func usage() {
    gom build       [options]   : Build with _vendor packages
    gom install     [options]   : Install bundled packages into _vendor directory, by default.
                                  GOM_VENDOR_NAME=. gom install [options], for regular src folder.
+                                 --frozen fails if Gomfile.lock doesn't match the Gomfile.
+                                 --force reinstalls the packages already up to date.
+                                 --offline installs from the $GOM_CACHE mirrors only.
+                                 --from BUNDLE installs the sources of a bundle.
    gom build_deps  [options]   : build bundled packages into _vendor directory, but do not download it.
    gom test        [options]   : Run tests with bundles
    gom run         [options]   : Run go file with bundles
    gom doc         [options]   : Run godoc for bundles
    gom exec        [arguments] : Execute command with bundle environment
-   gom outdated                : Display outdated packages
+   gom outdated    [--format]  : Display outdated packages
    gom tool        [options]   : Run go tool with bundles
-   gom check                   : Check if the vendored dependencies match the Gomfile
+   gom check       [--format]  : Check if the vendored dependencies match the Gomfile
+                   [--diff]      and show the local changes of dirty packages
    gom fmt         [arguments] : Run go fmt
    gom gen travis-yml          : Generate .travis.yml which uses "gom test"
    gom gen gomfile DIR         : Scan packages from current directory as root
                                  recursively, and generate Gomfile
-   gom lock                    : Generate Gomfile.lock
+   gom lock        [--format]  : Generate Gomfile.lock
+                                 --format json or tsv reports every package in a
+                                 machine readable way for outdated, check and lock
+   gom add PKG [options]       : Add PKG to the Gomfile and install it. Options are
+                                 written as in the Gomfile (":tag => 'v1'") and
+                                 --group NAME puts PKG in a group
+   gom remove PKG...           : Remove PKG from the Gomfile and the vendor directory
+   gom pin PKG...              : Set :commit of PKG in the Gomfile to its installed revision
+   gom unpin PKG...            : Remove :commit of PKG from the Gomfile
+   gom update [PKG...]         : Move packages to the newest revision allowed by the
+                                 Gomfile and regenerate Gomfile.lock
+   gom cache list              : List the mirrors of the shared cache and their size
+   gom cache prune [LOCK...]   : Remove the mirrors no known Gomfile.lock uses
+   gom cache fill [GOMFILE]    : Mirror every package the Gomfile needs, for offline installs
+   gom cache verify            : Check the integrity of the mirrors
+   gom bundle pack [-o FILE]   : Write the locked sources of the packages to a tar.gz
+                                 bundle, to install with gom install --from FILE
 `, os.Args[0])
 	os.Exit(1)
 }
@@ -34,6 +56,8 @@ var productionEnv = flag.Bool("production", false, "production environment")
 var developmentEnv = flag.Bool("development", false, "development environment")
 var testEnv = flag.Bool("test", false, "test environment")
 var customGroups = flag.String("groups", "", "comma-separated list of Gomfile groups")
+var jobs = flag.Int("jobs", runtime.NumCPU(), "number of packages fetched or built in parallel")
+var autoInstall = flag.Bool("auto-install", false, "reinstall stale packages before build, test, run and exec")
 var customGroupList []string
 var vendorFolder string
 
@@ -61,11 +85,11 @@ func main() {
 	subArgs := flag.Args()[1:]
 	switch flag.Arg(0) {
 	case "outdated":
-		err = outdated()
+		err = outdated(subArgs)
 	case "install", "i":
 		err = install(subArgs)
 	case "check":
-		err = checkStaleness()
+		err = check(subArgs)
 	case "build_deps":
 		if err = checkStaleness(); err == nil {
 			err = buildDeps(subArgs)
@@ -107,7 +131,21 @@ func main() {
 			usage()
 		}
 	case "lock", "l":
-		err = genGomfileLock()
+		err = lock(subArgs)
+	case "add":
+		err = addGom(subArgs)
+	case "remove", "rm":
+		err = removeGom(subArgs)
+	case "pin":
+		err = pinGom(subArgs)
+	case "unpin":
+		err = unpinGom(subArgs)
+	case "update", "u":
+		err = update(subArgs)
+	case "cache":
+		err = cacheCommand(subArgs)
+	case "bundle":
+		err = bundleCommand(subArgs)
 	default:
 		usage()
 	}
@@ -1,91 +1,18 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os/user"
+	"path/filepath"
 	"strings"
-
-	"github.com/bgentry/go-netrc/netrc"
 )
 
 type updates struct {
 	latestVersion string
 }
 
-type Commit struct {
-	Author struct {
-		AvatarURL         string `json:"avatar_url"`
-		EventsURL         string `json:"events_url"`
-		FollowersURL      string `json:"followers_url"`
-		FollowingURL      string `json:"following_url"`
-		GistsURL          string `json:"gists_url"`
-		GravatarID        string `json:"gravatar_id"`
-		HTMLURL           string `json:"html_url"`
-		ID                int    `json:"id"`
-		Login             string `json:"login"`
-		OrganizationsURL  string `json:"organizations_url"`
-		ReceivedEventsURL string `json:"received_events_url"`
-		ReposURL          string `json:"repos_url"`
-		SiteAdmin         bool   `json:"site_admin"`
-		StarredURL        string `json:"starred_url"`
-		SubscriptionsURL  string `json:"subscriptions_url"`
-		Type              string `json:"type"`
-		URL               string `json:"url"`
-	} `json:"author"`
-	CommentsURL string `json:"comments_url"`
-	Commit      struct {
-		Author struct {
-			Date  string `json:"date"`
-			Email string `json:"email"`
-			Name  string `json:"name"`
-		} `json:"author"`
-		CommentCount int `json:"comment_count"`
-		Committer    struct {
-			Date  string `json:"date"`
-			Email string `json:"email"`
-			Name  string `json:"name"`
-		} `json:"committer"`
-		Message string `json:"message"`
-		Tree    struct {
-			Sha string `json:"sha"`
-			URL string `json:"url"`
-		} `json:"tree"`
-		URL string `json:"url"`
-	} `json:"commit"`
-	Committer struct {
-		AvatarURL         string `json:"avatar_url"`
-		EventsURL         string `json:"events_url"`
-		FollowersURL      string `json:"followers_url"`
-		FollowingURL      string `json:"following_url"`
-		GistsURL          string `json:"gists_url"`
-		GravatarID        string `json:"gravatar_id"`
-		HTMLURL           string `json:"html_url"`
-		ID                int    `json:"id"`
-		Login             string `json:"login"`
-		OrganizationsURL  string `json:"organizations_url"`
-		ReceivedEventsURL string `json:"received_events_url"`
-		ReposURL          string `json:"repos_url"`
-		SiteAdmin         bool   `json:"site_admin"`
-		StarredURL        string `json:"starred_url"`
-		SubscriptionsURL  string `json:"subscriptions_url"`
-		Type              string `json:"type"`
-		URL               string `json:"url"`
-	} `json:"committer"`
-	HTMLURL string `json:"html_url"`
-	Parents []struct {
-		HTMLURL string `json:"html_url"`
-		Sha     string `json:"sha"`
-		URL     string `json:"url"`
-	} `json:"parents"`
-	Sha string `json:"sha"`
-	URL string `json:"url"`
-}
-
 var (
-	errProviderNotSupported = fmt.Errorf("Provider not supported")
+	errNotInstalled = errors.New("Not installed")
 )
 
 func packageName(name string) string {
@@ -94,78 +21,102 @@ func packageName(name string) string {
 	return strings.Join(tab[0:2], "/")
 }
 
-func getUpdates(g Gom) (*updates, error) {
-	if !strings.HasPrefix(g.name, "github.com/") {
-		return nil, errProviderNotSupported
-	}
-	usr, err := user.Current()
+// getUpdates asks the remote repository of the installed copy of g for the
+// latest revision of the branch g follows.
+func getUpdates(vendor string, g Gom) (*updates, error) {
+	vcs, root, err := getVcsCommand(vendor, filepath.Join(vendor, "src", g.name))
 	if err != nil {
-		return nil, err
+		return nil, errNotInstalled
 	}
-	dir := usr.HomeDir
-	machines, err := netrc.ParseFile(fmt.Sprintf("%s/.netrc", dir))
-	if err != nil {
-		return nil, err
+	if url, ok := g.options["url"].(string); ok {
+		// Only ask the repository of :url, not the one of an older install.
+		if remote, _ := vcs.RemoteURL(root); remote != url {
+			return nil, fmt.Errorf("installed from %s, not %s. Run `gom install` first", remote, url)
+		}
 	}
-
-	token := ""
-	m := machines.FindMachine("github.com")
-	if m == nil {
-		fmt.Printf("No github credential set")
-	} else {
-		token = m.Login
+	q, ok := vcs.(remoteQuerier)
+	if !ok {
+		return nil, fmt.Errorf("%s can't query the remote repository", vcs.Name())
 	}
-
-	res, err := http.Get(fmt.Sprintf("https://api.github.com/repos/%s/commits?access_token=%s", packageName(g.name), token))
+	branch, _ := g.options["branch"].(string)
+	latest, err := q.Latest(root, branch)
 	if err != nil {
 		return nil, err
 	}
+	return &updates{latestVersion: latest}, nil
+}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+// outdatedReport compares the pinned revision of g with the latest one of its
+// remote repository.
+func outdatedReport(vendor string, g Gom) packageReport {
+	report := packageReport{Name: g.name}
+	report.Pinned, _ = g.options["commit"].(string)
+	report.Installed = installedRevision(vendor, g.name)
+	if report.Pinned == "" {
+		report.Status = statusUnpinned
+		return report
 	}
 
-	commits := []*Commit{}
-	if err := json.Unmarshal(body, &commits); err != nil {
-		fmt.Printf("Error with unmarshal: %s: %s\n", err.Error(), string(body))
-		return nil, err
+	updates, err := getUpdates(vendor, g)
+	switch {
+	case err == errNotInstalled:
+		report.Status = statusNotInstalled
+	case err != nil:
+		report.Status = statusError
+		report.Error = err.Error()
+	case report.Pinned == updates.latestVersion:
+		report.Status = statusUpToDate
+		report.Latest = updates.latestVersion
+	default:
+		report.Status = statusOutdated
+		report.Latest = updates.latestVersion
 	}
-
-	return &updates{latestVersion: commits[0].Sha}, nil
+	return report
 }
 
-func outdated() error {
+func outdated(args []string) error {
+	format, err := parseFormatArgs("outdated", args)
+	if err != nil {
+		return err
+	}
 	allGoms, err := parseGomfile("Gomfile")
 	if err != nil {
 		return err
 	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
 
+	reports := []packageReport{}
 	for _, g := range allGoms {
-		fmt.Printf("%s\n", g.name)
-
-		commit := g.options["commit"]
-		if commit == "" {
-			fmt.Printf("  \\_ No commit set. Please set a revion with :commit => 'SHA1'")
+		report := outdatedReport(vendor, g)
+		reports = append(reports, report)
+		if format != formatText {
 			continue
 		}
 
-		updates, err := getUpdates(g)
-		if err == errProviderNotSupported {
-			fmt.Printf("  \\_ Unable to check on this provider. Only github.com is supported\n")
-			continue
-		} else if err != nil {
-			return err
-		}
-
-		if commit == updates.latestVersion {
+		fmt.Printf("%s\n", g.name)
+		switch report.Status {
+		case statusUnpinned:
+			fmt.Printf("  \\_ No commit set. Please set a revion with :commit => 'SHA1'\n")
+		case statusNotInstalled:
+			fmt.Printf("  \\_ Not installed. Run `gom install` first\n")
+		case statusError:
+			fmt.Printf("  \\_ Unable to check for updates: %s\n", report.Error)
+		case statusUpToDate:
 			fmt.Printf("  \\_ Up to date\n")
-		} else {
-			fmt.Printf("  \\_ Latest version: %s\n", updates.latestVersion)
-			fmt.Printf("  \\_ Tree: http://github.com/%s/tree/%s\n", packageName(g.name), updates.latestVersion)
-			fmt.Printf("  \\_ Compare changes: http://github.com/%s/compare/%s...%s\n", packageName(g.name), commit, updates.latestVersion)
+		default:
+			fmt.Printf("  \\_ Latest version: %s\n", report.Latest)
+			if strings.HasPrefix(g.name, "github.com/") {
+				fmt.Printf("  \\_ Tree: http://github.com/%s/tree/%s\n", packageName(g.name), report.Latest)
+				fmt.Printf("  \\_ Compare changes: http://github.com/%s/compare/%s...%s\n", packageName(g.name), report.Pinned, report.Latest)
+			}
 		}
 	}
 
+	if format != formatText {
+		return writeReports(stdout, format, reports)
+	}
 	return nil
 }
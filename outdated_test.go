@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetUpdates(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	work := filepath.Join(dir, "work")
+	first := gitRepo(t, work)
+	bare := filepath.Join(dir, "origin.git")
+	gitCmd(t, dir, "clone", "-q", "--bare", work, bare)
+
+	vendor := filepath.Join(dir, vendorFolder)
+	p := filepath.Join(vendor, "src", "example.com", "a")
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "clone", "-q", "file://"+bare, p)
+
+	g := Gom{name: "example.com/a", options: map[string]interface{}{"commit": first}}
+	u, err := getUpdates(vendor, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.latestVersion != first {
+		t.Fatalf("Expected %s, but %s:", first, u.latestVersion)
+	}
+
+	gitCmd(t, work, "commit", "-q", "--allow-empty", "-m", "second")
+	second := gitCmd(t, work, "rev-parse", "HEAD")
+	gitCmd(t, work, "checkout", "-q", "-b", "feature")
+	gitCmd(t, work, "commit", "-q", "--allow-empty", "-m", "feature")
+	feature := gitCmd(t, work, "rev-parse", "HEAD")
+	gitCmd(t, work, "push", "-q", bare, "--all")
+
+	u, err = getUpdates(vendor, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.latestVersion != second {
+		t.Fatalf("Expected %s, but %s:", second, u.latestVersion)
+	}
+
+	g.options["branch"] = "feature"
+	u, err = getUpdates(vendor, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.latestVersion != feature {
+		t.Fatalf("Expected %s, but %s:", feature, u.latestVersion)
+	}
+
+	if _, err := getUpdates(vendor, Gom{name: "example.com/missing"}); err != errNotInstalled {
+		t.Fatalf("Expected %v, but %v:", errNotInstalled, err)
+	}
+}
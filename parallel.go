@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// forEachGom calls fn for every gom, running up to *jobs calls at once. The
+// output of each call is buffered and printed in one piece when it returns,
+// and the first error cancels the calls still running and is returned.
+func forEachGom(goms []Gom, fn func(r *runner, gom *Gom) error) error {
+	return forEachGomInOrder(goms, nil, fn)
+}
+
+// forEachGomInOrder works like forEachGom, but only calls fn for a gom once
+// the calls for all the goms it depends on have succeeded. deps[i] holds the
+// indexes of the goms goms[i] depends on.
+func forEachGomInOrder(goms []Gom, deps [][]int, fn func(r *runner, gom *Gom) error) error {
+	pending := make([]int, len(goms))
+	dependents := make([][]int, len(goms))
+	for i := range deps {
+		pending[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	ready := []int{}
+	for i := range goms {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		i   int
+		err error
+		out *bytes.Buffer
+	}
+	done := make(chan result)
+	running, finished := 0, 0
+	var firstErr error
+	for finished < len(goms) {
+		for firstErr == nil && len(ready) > 0 && (running == 0 || running < *jobs) {
+			i := ready[0]
+			ready = ready[1:]
+			running++
+			go func(i int) {
+				if *jobs <= 1 {
+					r := directRunner()
+					r.ctx = ctx
+					done <- result{i, fn(r, &goms[i]), nil}
+					return
+				}
+				var buf bytes.Buffer
+				r := &runner{ctx: ctx, stdout: &buf, stderr: &buf}
+				done <- result{i, fn(r, &goms[i]), &buf}
+			}(i)
+		}
+		if running == 0 {
+			if firstErr == nil {
+				firstErr = circularDependencies(goms, pending)
+			}
+			break
+		}
+
+		res := <-done
+		running--
+		finished++
+		if res.out != nil {
+			stdout.Write(res.out.Bytes())
+		}
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
+		}
+		for _, j := range dependents[res.i] {
+			pending[j]--
+			if pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	return firstErr
+}
+
+func circularDependencies(goms []Gom, pending []int) error {
+	names := []string{}
+	for i, n := range pending {
+		if n > 0 {
+			names = append(names, goms[i].name)
+		}
+	}
+	sort.Strings(names)
+	return fmt.Errorf("circular dependencies between %s", strings.Join(names, ", "))
+}
+
+var repoLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+// lockRepository serializes the work done on the repository holding gom, as
+// concurrent VCS commands on the same checkout conflict. It returns the
+// function releasing the lock.
+func lockRepository(gom *Gom) func() {
+	key := gom.repositoryRoot()
+
+	repoLocks.Lock()
+	mu, ok := repoLocks.m[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		repoLocks.m[key] = mu
+	}
+	repoLocks.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEachGom(t *testing.T) {
+	f, err := ioutil.TempFile("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	oldstdout, oldjobs := stdout, *jobs
+	defer func() {
+		stdout, *jobs = oldstdout, oldjobs
+	}()
+	stdout, *jobs = f, 4
+
+	goms := []Gom{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		goms = append(goms, Gom{name: name})
+	}
+	var calls int32
+	err = forEachGom(goms, func(r *runner, gom *Gom) error {
+		atomic.AddInt32(&calls, 1)
+		r.printf("%s 1\n", gom.name)
+		r.printf("%s 2\n", gom.name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if calls != int32(len(goms)) {
+		t.Fatalf("Expected %d calls, but %d:", len(goms), calls)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for i := 0; i < len(lines); i += 2 {
+		name := strings.Fields(lines[i])[0]
+		if lines[i] != name+" 1" || lines[i+1] != name+" 2" {
+			t.Fatalf("Output of %s is interleaved: %q", name, lines)
+		}
+	}
+
+	failure := errors.New("failure")
+	err = forEachGom(goms, func(r *runner, gom *Gom) error {
+		if gom.name == "b" {
+			return failure
+		}
+		<-r.ctx.Done()
+		return r.ctx.Err()
+	})
+	if err != failure {
+		t.Fatalf("Expected %v, but %v:", failure, err)
+	}
+}
+
+func TestForEachGomInOrder(t *testing.T) {
+	oldjobs := *jobs
+	defer func() {
+		*jobs = oldjobs
+	}()
+	*jobs = 4
+
+	goms := []Gom{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}}
+	deps := [][]int{{1, 2}, {3}, {3}, nil}
+	var mu sync.Mutex
+	built := map[string]bool{}
+	err := forEachGomInOrder(goms, deps, func(r *runner, gom *Gom) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := range goms {
+			if &goms[i] != gom {
+				continue
+			}
+			for _, j := range deps[i] {
+				if !built[goms[j].name] {
+					t.Errorf("%s built before %s", gom.name, goms[j].name)
+				}
+			}
+		}
+		built[gom.name] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != len(goms) {
+		t.Fatalf("Expected %d builds, but %d:", len(goms), len(built))
+	}
+
+	err = forEachGomInOrder(goms, [][]int{{1}, {0}, nil, nil}, func(r *runner, gom *Gom) error {
+		return nil
+	})
+	if err == nil || err.Error() != "circular dependencies between a, b" {
+		t.Fatalf("Expected a circular dependencies error, but %v:", err)
+	}
+}
+
+func TestInstallSubpackagesInParallel(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache, oldjobs := os.Getenv("GOM_CACHE"), *jobs
+	defer func() {
+		os.Setenv("GOM_CACHE", oldcache)
+		*jobs = oldjobs
+	}()
+	cache := filepath.Join(dir, "cache")
+	os.Setenv("GOM_CACHE", cache)
+	*jobs = 4
+
+	origin := filepath.Join(dir, "origin")
+	rev := gitRepo(t, origin)
+	gitCmd(t, dir, "clone", "-q", "--mirror", origin, filepath.Join(cache, "example.com", "a"))
+
+	goms := []Gom{
+		{name: "example.com/a/sub", options: map[string]interface{}{"commit": rev}},
+		{name: "example.com/a", options: map[string]interface{}{"commit": rev}},
+		{name: "example.com/a/other", options: map[string]interface{}{"commit": rev}},
+	}
+	for i := 0; i < 5; i++ {
+		os.RemoveAll(filepath.Join(dir, vendorFolder, "src"))
+		err := forEachGom(goms, func(r *runner, gom *Gom) error {
+			defer lockRepository(gom)()
+			if err := gom.Clone(r); err != nil {
+				return err
+			}
+			return gom.Checkout(r)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// pinGom sets the :commit of packages in the Gomfile to their installed
+// revision, leaving the rest of the Gomfile as written, and refreshes
+// Gomfile.lock.
+func pinGom(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no package given")
+	}
+	doc, err := readDocument("Gomfile")
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		rev := installedRevision(vendor, name)
+		if rev == "" {
+			return fmt.Errorf("%s is not installed. Run `gom install` first", name)
+		}
+		err = doc.SetOption(name, "commit", rev)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("pinning %s at %s\n", name, shortRevision(rev))
+	}
+
+	err = doc.Save()
+	if err != nil {
+		return err
+	}
+	return refreshGomfileLock()
+}
+
+// unpinGom removes the :commit of packages from the Gomfile, so that they
+// follow their branch or tag again, and refreshes Gomfile.lock.
+func unpinGom(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no package given")
+	}
+	doc, err := readDocument("Gomfile")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if decl, _ := doc.Lookup(name); decl == nil {
+			return fmt.Errorf("%s is not in Gomfile", name)
+		}
+		err = doc.RemoveOption(name, "commit")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("unpinning %s\n", name)
+	}
+
+	err = doc.Save()
+	if err != nil {
+		return err
+	}
+	return refreshGomfileLock()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPinGom(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	rev := gitRepo(t, filepath.Join(dir, vendorFolder, "src", "example.com", "a"))
+	gomfile := "# dependencies\ngom 'example.com/a', :branch => 'master' # follows master\n\ngroup :test do\n  gom 'example.com/b'\nend\n"
+	if err := ioutil.WriteFile("Gomfile", []byte(gomfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pinGom([]string{"example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "# dependencies\ngom 'example.com/a', :branch => 'master', :commit => '" + rev + "' # follows master\n\ngroup :test do\n  gom 'example.com/b'\nend\n"
+	if b, _ := ioutil.ReadFile("Gomfile"); string(b) != expected {
+		t.Fatalf("Expected %q, but %q:", expected, b)
+	}
+	if err := pinGom([]string{"example.com/b"}); err == nil {
+		t.Fatalf("Expected example.com/b not to be pinned")
+	}
+
+	if err := unpinGom([]string{"example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile("Gomfile"); string(b) != gomfile {
+		t.Fatalf("Expected %q, but %q:", gomfile, b)
+	}
+}
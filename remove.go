@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// removeGom removes packages from the Gomfile, deletes their sources and
+// build results from the vendor directory and refreshes Gomfile.lock.
+func removeGom(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no package given")
+	}
+	doc, err := readDocument("Gomfile")
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	targets := []string{}
+	for _, name := range names {
+		decl, _ := doc.Lookup(name)
+		if decl == nil {
+			return fmt.Errorf("%s is not in Gomfile", name)
+		}
+		target, ok := decl.options()["target"].(string)
+		if !ok {
+			target = name
+		}
+		err = doc.Remove(name)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	remaining := declaredGoms(doc.file.Stmts, make([]Gom, 0))
+	for i, name := range names {
+		fmt.Printf("removing %s\n", name)
+		err = removeSources(vendor, targets[i], remaining)
+		if err != nil {
+			return err
+		}
+		archives, err := filepath.Glob(filepath.Join(vendor, "pkg", "*", targets[i]+".a"))
+		if err != nil {
+			return err
+		}
+		for _, archive := range archives {
+			err = os.Remove(archive)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = doc.Save()
+	if err != nil {
+		return err
+	}
+	return refreshGomfileLock()
+}
+
+// removeSources deletes the checkout holding target from the vendor
+// directory, unless a remaining package of the Gomfile lives in it too.
+// Removing part of a checkout would leave it dirty.
+func removeSources(vendor, target string, remaining []Gom) error {
+	dir := filepath.Join(vendor, "src", target)
+	if _, root, err := getVcsCommand(vendor, dir); err == nil {
+		dir = root
+	}
+	for _, gom := range remaining {
+		other, ok := gom.options["target"].(string)
+		if !ok {
+			other = gom.name
+		}
+		p := filepath.Join(vendor, "src", other)
+		if p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			rel, _ := filepath.Rel(filepath.Join(vendor, "src"), dir)
+			fmt.Printf("  \\_ keeping %s, %s still uses it\n", filepath.ToSlash(rel), gom.name)
+			return nil
+		}
+	}
+	return os.RemoveAll(dir)
+}
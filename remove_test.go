@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveSubpackage(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	root := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	gitRepo(t, root)
+	for _, sub := range []string{"sub", "other"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, sub, "x.go"), []byte("package x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, root, "add", ".")
+	gitCmd(t, root, "commit", "-q", "-m", "subpackages")
+	gomfile := "gom 'example.com/a/sub'\ngom 'example.com/a/other'\n"
+	if err := ioutil.WriteFile("Gomfile", []byte(gomfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeGom([]string{"example.com/a/sub"}); err != nil {
+		t.Fatal(err)
+	}
+	other := Gom{name: "example.com/a/other", options: map[string]interface{}{}}
+	if report := checkReport(filepath.Join(dir, vendorFolder), other); report.Status != statusUnpinned {
+		t.Fatalf("Expected %v, but %v %v:", statusUnpinned, report.Status, report.Error)
+	}
+
+	if err := removeGom([]string{"example.com/a/other"}); err != nil {
+		t.Fatal(err)
+	}
+	if isDir(root) {
+		t.Fatalf("Expected %s to be removed", root)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// httpClient fetches the go-import meta tags of import paths.
+var httpClient = http.DefaultClient
+
+// repoRoot is the repository an import path belongs to.
+type repoRoot struct {
+	vcs VCS
+	// root is the import path of the repository, url where it is cloned
+	// from.
+	root string
+	url  string
+}
+
+// knownHosts are the hosts whose repositories are the first three elements
+// of the import path and served by git over https.
+var knownHosts = []string{"github.com", "bitbucket.org", "gitlab.com"}
+
+// resolveRepo finds the repository of importPath like `go get` does: from
+// its known host, from a VCS suffix such as example.com/repo.git, or from
+// the go-import meta tag of https://importPath?go-get=1. The last one needs
+// the network, so it isn't tried offline.
+func resolveRepo(importPath string) (*repoRoot, error) {
+	if repo := staticRepo(importPath); repo != nil {
+		return repo, nil
+	}
+	if offline {
+		return nil, fmt.Errorf("%s: can't find its repository offline", importPath)
+	}
+	discovered.Lock()
+	repo, ok := discovered.m[importPath]
+	discovered.Unlock()
+	if ok {
+		return repo, nil
+	}
+	repo, err := discoverRepo(importPath)
+	if err != nil {
+		return nil, err
+	}
+	discovered.Lock()
+	discovered.m[importPath] = repo
+	discovered.Unlock()
+	return repo, nil
+}
+
+// discovered remembers the repositories found by discoverRepo, which are
+// asked for several times during an install.
+var discovered = struct {
+	sync.Mutex
+	m map[string]*repoRoot
+}{m: map[string]*repoRoot{}}
+
+// repositoryRoot returns the import path of the repository holding gom:
+// the one of its installed checkout, of its mirror in the cache or found by
+// Gom.repo, or the name of gom when none of them knows.
+func (gom *Gom) repositoryRoot() string {
+	target, ok := gom.options["target"].(string)
+	if !ok {
+		target = gom.name
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return target
+	}
+	src := filepath.Join(vendor, "src")
+	if _, dir, err := getVcsCommand(vendor, filepath.Join(src, target)); err == nil {
+		if root, err := filepath.Rel(src, dir); err == nil {
+			return filepath.ToSlash(root)
+		}
+	}
+	if gom.fetchedItself() {
+		return target
+	}
+	if cache, err := cacheDir(); err == nil && cache != "" {
+		elems := strings.Split(gom.name, "/")
+		for i := 1; i <= len(elems); i++ {
+			root := strings.Join(elems[:i], "/")
+			if mirrorAt(filepath.Join(cache, filepath.FromSlash(root))) != nil {
+				return root
+			}
+		}
+	}
+	if repo, err := gom.repo(); err == nil {
+		return repo.root
+	}
+	return gom.name
+}
+
+// staticRepo finds the repository of importPath from the import path alone,
+// or returns nil.
+func staticRepo(importPath string) *repoRoot {
+	elems := strings.Split(importPath, "/")
+	if len(elems) >= 3 && has(knownHosts, elems[0]) {
+		root := strings.Join(elems[:3], "/")
+		return &repoRoot{vcs: git, root: root, url: "https://" + root}
+	}
+	for i := 1; i < len(elems); i++ {
+		for _, vcs := range vcsList {
+			if strings.HasSuffix(elems[i], "."+vcs.Name()) {
+				root := strings.Join(elems[:i+1], "/")
+				return &repoRoot{vcs: vcs, root: root, url: "https://" + root}
+			}
+		}
+	}
+	return nil
+}
+
+// repo returns the repository of gom. With :url, it is cloned from there
+// with :vcs, git by default, and the canonical host is never asked: the
+// repository root is the package itself unless the import path tells it.
+// The others are found with resolveRepo.
+func (gom *Gom) repo() (*repoRoot, error) {
+	url, ok := gom.options["url"].(string)
+	if !ok {
+		return resolveRepo(gom.name)
+	}
+	name, ok := gom.options["vcs"].(string)
+	if !ok {
+		name = "git"
+	}
+	vcs := vcsByName(name)
+	if vcs == nil {
+		return nil, fmt.Errorf("%s: unknown VCS %q", gom.name, name)
+	}
+	root := gom.name
+	if repo := staticRepo(gom.name); repo != nil {
+		root = repo.root
+	}
+	return &repoRoot{vcs: vcs, root: root, url: url}, nil
+}
+
+// followURL points the installed checkout of gom to its :url when it was
+// cloned from another repository, so that it is fetched from there.
+func (gom *Gom) followURL(r *runner, vendor string) error {
+	if !has(gom.options, "url") {
+		return nil
+	}
+	repo, err := gom.repo()
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(vendor, "src", filepath.FromSlash(repo.root))
+	vcs := mirrorerOf(vcsAt(dest))
+	if vcs == nil {
+		return nil
+	}
+	if url, _ := vcs.RemoteURL(dest); url != repo.url {
+		r.printf("fetching %s from %s\n", repo.root, repo.url)
+		return vcs.SetRemote(dest, repo.url)
+	}
+	return nil
+}
+
+// discoverRepo reads the go-import meta tags served for importPath.
+func discoverRepo(importPath string) (*repoRoot, error) {
+	resp, err := httpClient.Get("https://" + importPath + "?go-get=1")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", importPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", importPath, resp.Status)
+	}
+	imports, err := parseMetaGoImports(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", importPath, err)
+	}
+
+	var found *repoRoot
+	for _, fields := range imports {
+		prefix, vcsName, url := fields[0], fields[1], fields[2]
+		if importPath != prefix && !strings.HasPrefix(importPath, prefix+"/") {
+			continue
+		}
+		vcs := vcsByName(vcsName)
+		if vcs == nil {
+			if vcsName == "mod" {
+				// Module proxies serve zips rather than repositories.
+				continue
+			}
+			return nil, fmt.Errorf("%s: unknown VCS %q", importPath, vcsName)
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: several go-import meta tags match", importPath)
+		}
+		found = &repoRoot{vcs: vcs, root: prefix, url: url}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no go-import meta tag", importPath)
+	}
+	return found, nil
+}
+
+// parseMetaGoImports returns the prefix, VCS and URL of the go-import meta
+// tags of the head of an HTML page.
+func parseMetaGoImports(r io.Reader) ([][3]string, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	imports := [][3]string{}
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			return imports, nil
+		}
+		if err != nil {
+			if len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") || attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if fields := strings.Fields(attrValue(e.Attr, "content")); len(fields) == 3 {
+			imports = append(imports, [3]string{fields[0], fields[1], fields[2]})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// shallowRevision returns the revision gom is cloned at without history:
+// its :commit, or its :tag if it isn't a version constraint. It is empty
+// for the other packages and with :shallow => 'false'.
+func (gom *Gom) shallowRevision() string {
+	if shallow, ok := gom.options["shallow"].(string); ok && shallow == "false" {
+		return ""
+	}
+	if commit, ok := gom.options["commit"].(string); ok {
+		return commit
+	}
+	if tag, ok := gom.options["tag"].(string); ok && !isVersionConstraint(tag) {
+		return tag
+	}
+	return ""
+}
+
+// cloneDirect clones the repository of gom in the vendor directory with its
+// VCS, unless it is there already. Checking out the wanted revision is left
+// to Checkout.
+func (gom *Gom) cloneDirect(r *runner, vendor string) error {
+	repo, err := gom.repo()
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(vendor, "src", filepath.FromSlash(repo.root))
+	if vcsAt(dest) != nil {
+		return nil
+	}
+	if rev := gom.shallowRevision(); rev != "" {
+		if s, ok := repo.vcs.(shallowFetcher); ok {
+			r.printf("downloading %s at %s\n", repo.root, shortRevision(rev))
+			return s.ShallowClone(r, repo.url, dest, rev)
+		}
+	}
+	r.printf("downloading %s\n", repo.root)
+	return repo.vcs.Clone(r, repo.url, dest)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMetaGoImports(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head>
+<meta name="go-import" content="example.com/a git https://code.example.com/a.git">
+<META NAME="go-import" CONTENT="example.com/b mod https://proxy.example.com">
+<meta name="go-source" content="example.com/a _ _ _">
+</head><body><meta name="go-import" content="example.com/c git https://example.com/c"></body></html>`
+	imports, err := parseMetaGoImports(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][3]string{
+		{"example.com/a", "git", "https://code.example.com/a.git"},
+		{"example.com/b", "mod", "https://proxy.example.com"},
+	}
+	if fmt.Sprint(imports) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v, but %v:", expected, imports)
+	}
+}
+
+func TestResolveRepo(t *testing.T) {
+	defer func() {
+		offline = false
+	}()
+	offline = true
+	cases := []struct {
+		path, root, url string
+		vcs             VCS
+	}{
+		{"github.com/heetch/gom/sub", "github.com/heetch/gom", "https://github.com/heetch/gom", git},
+		{"example.com/a.hg/sub", "example.com/a.hg", "https://example.com/a.hg", hg},
+	}
+	for _, c := range cases {
+		repo, err := resolveRepo(c.path)
+		if err != nil || repo.root != c.root || repo.url != c.url || repo.vcs != c.vcs {
+			t.Fatalf("Expected %s at %s, but %v %v:", c.root, c.url, repo, err)
+		}
+	}
+	if _, err := resolveRepo("example.com/a"); err == nil {
+		t.Fatalf("Expected example.com/a not to be resolved offline")
+	}
+}
+
+// goImportServer serves the go-import meta tag of host/a, pointing to the
+// git repository origin, and returns the host.
+func goImportServer(t *testing.T, origin string) (string, func()) {
+	var host string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.FormValue("go-get") != "1" || !strings.HasPrefix(req.URL.Path, "/a") {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s/a git %s"></head></html>`, host, origin)
+	}))
+	host = strings.TrimPrefix(server.URL, "https://")
+	oldClient := httpClient
+	httpClient = server.Client()
+	return host, func() {
+		httpClient = oldClient
+		server.Close()
+	}
+}
+
+func TestDiscoverRepo(t *testing.T) {
+	host, closeServer := goImportServer(t, "/nonexistent")
+	defer closeServer()
+
+	repo, err := resolveRepo(host + "/a/sub")
+	if err != nil || repo.root != host+"/a" || repo.url != "/nonexistent" || repo.vcs != git {
+		t.Fatalf("Expected %s/a, but %v %v:", host, repo, err)
+	}
+	if _, err := resolveRepo(host + "/b"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Expected %s/b not to be found, but %v:", host, err)
+	}
+}
+
+func TestCloneDirect(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache := os.Getenv("GOM_CACHE")
+	defer os.Setenv("GOM_CACHE", oldcache)
+
+	origin := filepath.Join(dir, "origin")
+	rev1 := gitRepo(t, origin)
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	host, closeServer := goImportServer(t, origin)
+	defer closeServer()
+
+	for _, cache := range []string{"off", filepath.Join(dir, "cache")} {
+		os.Setenv("GOM_CACHE", cache)
+		dest := filepath.Join(dir, vendorFolder, "src", host, "a")
+		os.RemoveAll(dest)
+
+		gom := &Gom{name: host + "/a/sub", options: map[string]interface{}{"commit": rev1}}
+		if err := gom.Clone(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if err := gom.Checkout(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if rev, err := git.Revision(dest); err != nil || rev != rev1 {
+			t.Fatalf("Expected %v with the cache %s, but %v %v:", rev1, cache, rev, err)
+		}
+	}
+}
+
+func TestShallowClone(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache := os.Getenv("GOM_CACHE")
+	defer os.Setenv("GOM_CACHE", oldcache)
+	os.Setenv("GOM_CACHE", "off")
+
+	// The pinned revisions are neither the root nor the tip, so that a
+	// clone with history has more than one commit.
+	origin := filepath.Join(dir, "origin")
+	gitRepo(t, origin)
+	revs := []string{}
+	for i := 0; i < 5; i++ {
+		gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", fmt.Sprint("commit ", i))
+		revs = append(revs, gitCmd(t, origin, "rev-parse", "HEAD"))
+	}
+	rev1, rev2 := revs[1], revs[2]
+	gitCmd(t, origin, "tag", "v2", rev2)
+	// Local paths are cloned with their history, file URLs aren't.
+	host, closeServer := goImportServer(t, "file://"+origin)
+	defer closeServer()
+	dest := filepath.Join(dir, vendorFolder, "src", host, "a")
+
+	cases := []struct {
+		options map[string]interface{}
+		rev     string
+		commits string
+	}{
+		{map[string]interface{}{"commit": rev1, "shallow": "false"}, rev1, "3"},
+		{map[string]interface{}{"tag": "~> 2.0"}, rev2, ""},
+		{map[string]interface{}{"tag": "v2"}, rev2, "1"},
+		{map[string]interface{}{"commit": rev1}, rev1, "1"},
+	}
+	for _, c := range cases {
+		os.RemoveAll(dest)
+		gom := &Gom{name: host + "/a", options: c.options}
+		if err := gom.Clone(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if err := gom.Checkout(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if rev, err := git.Revision(dest); err != nil || rev != c.rev {
+			t.Fatalf("Expected %v for %v, but %v %v:", c.rev, c.options, rev, err)
+		}
+		shallow := gom.shallowRevision() != ""
+		if git.IsShallow(dest) != shallow {
+			t.Fatalf("Expected %v to be shallow: %v", c.options, shallow)
+		}
+		if commits := gitCmd(t, dest, "rev-list", "--count", "HEAD"); c.commits != "" && commits != c.commits {
+			t.Fatalf("Expected %v commits for %v, but %v:", c.commits, c.options, commits)
+		}
+	}
+
+	// Moving the pin of the shallow checkout fetches the new revision.
+	gom := &Gom{name: host + "/a", options: map[string]interface{}{"commit": rev2}}
+	if err := gom.Checkout(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := git.Revision(dest); err != nil || rev != rev2 {
+		t.Fatalf("Expected %v, but %v %v:", rev2, rev, err)
+	}
+	if commits := gitCmd(t, dest, "rev-list", "--count", "HEAD"); commits != "1" {
+		t.Fatalf("Expected 1 commit, but %v:", commits)
+	}
+}
+
+func TestShallowCloneWithCache(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	origin := filepath.Join(dir, "origin")
+	rev1 := gitRepo(t, origin)
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	host, closeServer := goImportServer(t, "file://"+origin)
+	defer closeServer()
+	dest := filepath.Join(dir, vendorFolder, "src", host, "a")
+
+	// The default cache doesn't have the repository yet: it is cloned
+	// shallowly rather than mirrored.
+	gom := &Gom{name: host + "/a", options: map[string]interface{}{"commit": rev1}}
+	if err := gom.Clone(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gom.Checkout(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := git.Revision(dest); err != nil || rev != rev1 {
+		t.Fatalf("Expected %v, but %v %v:", rev1, rev, err)
+	}
+	if !git.IsShallow(dest) {
+		t.Fatal("Expected a shallow clone")
+	}
+	cache, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mirrorAt(filepath.Join(cache, host, "a")) != nil {
+		t.Fatal("Expected the repository not to be mirrored")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestURLOption(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	oldcache, oldClient := os.Getenv("GOM_CACHE"), httpClient
+	defer func() {
+		os.Setenv("GOM_CACHE", oldcache)
+		httpClient = oldClient
+	}()
+	httpClient = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("Expected %s not to be asked", req.URL)
+		return nil, fmt.Errorf("no network")
+	})}
+
+	fork := filepath.Join(dir, "fork")
+	rev1 := gitRepo(t, fork)
+	other := filepath.Join(dir, "other")
+	gitCmd(t, dir, "clone", "-q", fork, other)
+	vendor := filepath.Join(dir, vendorFolder)
+	dest := filepath.Join(vendor, "src", "example.com", "a")
+
+	for _, cache := range []string{"off", filepath.Join(dir, "cache")} {
+		os.Setenv("GOM_CACHE", cache)
+		os.RemoveAll(dest)
+		gom := Gom{name: "example.com/a", options: map[string]interface{}{"url": fork, "vcs": "git", "commit": rev1}}
+		if err := gom.Clone(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if err := gom.Checkout(directRunner()); err != nil {
+			t.Fatal(err)
+		}
+		if url, _ := git.RemoteURL(dest); url != fork {
+			t.Fatalf("Expected %v with the cache %s, but %v:", fork, cache, url)
+		}
+		if report := checkReport(vendor, gom); report.Status != statusOK {
+			t.Fatalf("Expected %v, but %v %v:", statusOK, report.Status, report.Error)
+		}
+	}
+
+	gom := Gom{name: "example.com/a", options: map[string]interface{}{"url": other, "commit": rev1}}
+	if report := checkReport(vendor, gom); report.Status != statusWrongURL {
+		t.Fatalf("Expected %v, but %v:", statusWrongURL, report.Status)
+	}
+	if report := outdatedReport(vendor, gom); report.Status != statusError || !strings.Contains(report.Error, fork) {
+		t.Fatalf("Expected %v, but %v %v:", statusError, report.Status, report.Error)
+	}
+	if err := gom.Clone(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if report := checkReport(vendor, gom); report.Status != statusOK {
+		t.Fatalf("Expected %v, but %v %v:", statusOK, report.Status, report.Error)
+	}
+
+	lw := &lockWriter{vendor: vendor, previous: make(map[string]Gom)}
+	cases := []struct {
+		gom Gom
+		url interface{}
+	}{
+		{Gom{name: "example.com/a", options: map[string]interface{}{"url": fork}}, fork},
+		{Gom{name: "example.com/a", options: map[string]interface{}{}}, other},
+		{Gom{name: "example.com/a/sub", options: map[string]interface{}{}}, nil},
+	}
+	os.MkdirAll(filepath.Join(dest, "sub"), 0755)
+	for _, c := range cases {
+		if _, err := lw.lockGom(&c.gom); err != nil {
+			t.Fatal(err)
+		}
+		if c.gom.options["url"] != c.url || c.gom.options["vcs"] != "git" {
+			t.Fatalf("Expected %s to be locked with %v, but %v:", c.gom.name, c.url, c.gom.options)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// packageReport is the state of a package as reported by `gom outdated`,
+// `gom check` and `gom lock` in their machine readable formats.
+type packageReport struct {
+	Name      string `json:"name"`
+	Pinned    string `json:"pinned,omitempty"`
+	Installed string `json:"installed,omitempty"`
+	Latest    string `json:"latest,omitempty"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	// Changes lists the local changes of a dirty checkout.
+	Changes []fileChange `json:"changes,omitempty"`
+}
+
+// Statuses of the reports.
+const (
+	statusOK               = "ok"
+	statusUnpinned         = "unpinned"
+	statusNotInstalled     = "not-installed"
+	statusError            = "error"
+	statusUpToDate         = "up-to-date"
+	statusOutdated         = "outdated"
+	statusMissing          = "missing"
+	statusWrongRevision    = "wrong-revision"
+	statusUnknownVCS       = "unknown-vcs"
+	statusChecksumMismatch = "checksum-mismatch"
+	statusDirty            = "dirty"
+	statusWrongURL         = "wrong-url"
+	statusLocked           = "locked"
+	statusPrevious         = "previous"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatTSV  = "tsv"
+)
+
+// reportFlagSet returns the flags of a reporting command along with its
+// --format flag.
+func reportFlagSet(command string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	format := fs.String("format", formatText, "output format: text, json or tsv")
+	return fs, format
+}
+
+// parseReportFlags parses args with fs and validates the format.
+func parseReportFlags(fs *flag.FlagSet, format *string, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	switch *format {
+	case formatText, formatJSON, formatTSV:
+		return *format, nil
+	}
+	return "", fmt.Errorf("unknown format %q", *format)
+}
+
+// parseFormatArgs parses the arguments of the reporting commands which only
+// take the --format flag.
+func parseFormatArgs(command string, args []string) (string, error) {
+	fs, format := reportFlagSet(command)
+	return parseReportFlags(fs, format, args)
+}
+
+// writeReports writes the reports as a JSON array or as tab separated values
+// with a header line.
+func writeReports(w io.Writer, format string, reports []packageReport) error {
+	if format == formatJSON {
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+
+	clean := strings.NewReplacer("\t", " ", "\n", " ")
+	fmt.Fprintln(w, "name\tpinned\tinstalled\tlatest\tstatus\terror")
+	for _, r := range reports {
+		fields := []string{r.Name, r.Pinned, r.Installed, r.Latest, r.Status, r.Error}
+		for i := range fields {
+			fields[i] = clean.Replace(fields[i])
+		}
+		_, err := fmt.Fprintln(w, strings.Join(fields, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteReports(t *testing.T) {
+	reports := []packageReport{
+		{Name: "example.com/a", Pinned: "abc", Installed: "abc", Status: statusOK},
+		{Name: "example.com/b", Status: statusError, Error: "exit status 128\n\tfatal"},
+	}
+
+	var buf bytes.Buffer
+	if err := writeReports(&buf, formatJSON, reports); err != nil {
+		t.Fatal(err)
+	}
+	expected := `[
+  {
+    "name": "example.com/a",
+    "pinned": "abc",
+    "installed": "abc",
+    "status": "ok"
+  },
+  {
+    "name": "example.com/b",
+    "status": "error",
+    "error": "exit status 128\n\tfatal"
+  }
+]
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, but %q:", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeReports(&buf, formatTSV, reports); err != nil {
+		t.Fatal(err)
+	}
+	expected = "name\tpinned\tinstalled\tlatest\tstatus\terror\n" +
+		"example.com/a\tabc\tabc\t\tok\t\n" +
+		"example.com/b\t\t\t\terror\texit status 128  fatal\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, but %q:", expected, buf.String())
+	}
+}
+
+func TestParseFormatArgs(t *testing.T) {
+	for _, args := range [][]string{{"--format", "json"}, {"-format=json"}} {
+		format, err := parseFormatArgs("check", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != formatJSON {
+			t.Fatalf("Expected %q, but %q:", formatJSON, format)
+		}
+	}
+	if _, err := parseFormatArgs("check", []string{"--format", "xml"}); err == nil {
+		t.Fatal("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a semantic version such as v1.2.3 or 1.2.0-beta.1. Missing minor
+// and patch numbers are 0.
+type version struct {
+	major, minor, patch int
+	pre                 string
+	parts               int // number of dotted numbers written
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.pre = s[:i], s[i+1:]
+		if v.pre == "" {
+			return v, false
+		}
+	}
+	nums := strings.Split(s, ".")
+	if len(nums) > 3 {
+		return v, false
+	}
+	for i, num := range nums {
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		switch i {
+		case 0:
+			v.major = n
+		case 1:
+			v.minor = n
+		case 2:
+			v.patch = n
+		}
+	}
+	v.parts = len(nums)
+	return v, true
+}
+
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	return comparePrerelease(v.pre, o.pre)
+}
+
+// comparePrerelease compares dot separated prerelease identifiers, numeric
+// ones numerically, as semver specifies.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// versionConstraint is a single comparison such as ">= 1.0".
+type versionConstraint struct {
+	op string
+	v  version
+}
+
+// versionOperators are the operators a constraint can start with, longest
+// first so that ">=" isn't read as ">".
+var versionOperators = []string{"~>", ">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+// isVersionConstraint tells whether a :tag option is a constraint to resolve
+// against the repository tags rather than the name of a tag.
+func isVersionConstraint(s string) bool {
+	s = strings.TrimSpace(s)
+	for _, op := range versionOperators {
+		if strings.HasPrefix(s, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVersionConstraints parses comma separated constraints which must all
+// be satisfied, like "~> 1.2", ">= 1.0, < 2.0" or "^0.3".
+func parseVersionConstraints(s string) ([]versionConstraint, error) {
+	cs := []versionConstraint{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "="
+		for _, o := range versionOperators {
+			if strings.HasPrefix(part, o) {
+				op = o
+				break
+			}
+		}
+		v, ok := parseVersion(strings.TrimPrefix(part, op))
+		if !ok {
+			return nil, fmt.Errorf("invalid version constraint %q", s)
+		}
+		cs = append(cs, expandConstraint(op, v)...)
+	}
+	return cs, nil
+}
+
+// expandConstraint turns the ~>, ~ and ^ ranges into plain comparisons.
+func expandConstraint(op string, v version) []versionConstraint {
+	upper := v
+	upper.pre = ""
+	switch op {
+	case "~>":
+		// ~> 1.2 allows 1.x from 1.2, ~> 1.2.3 allows 1.2.x from 1.2.3.
+		switch v.parts {
+		case 1, 2:
+			upper = version{major: v.major + 1}
+		default:
+			upper = version{major: v.major, minor: v.minor + 1}
+		}
+	case "~":
+		if v.parts == 1 {
+			upper = version{major: v.major + 1}
+		} else {
+			upper = version{major: v.major, minor: v.minor + 1}
+		}
+	case "^":
+		switch {
+		case v.major > 0 || v.parts == 1:
+			upper = version{major: v.major + 1}
+		case v.minor > 0 || v.parts == 2:
+			upper = version{minor: v.minor + 1}
+		default:
+			upper = version{patch: v.patch + 1}
+		}
+	default:
+		return []versionConstraint{{op, v}}
+	}
+	// Prereleases of the upper bound are below it but outside the range.
+	upper.pre = "0"
+	return []versionConstraint{{">=", v}, {"<", upper}}
+}
+
+func (c versionConstraint) match(v version) bool {
+	d := v.compare(c.v)
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	}
+	return false
+}
+
+// matchVersion tells whether tag is a version satisfying all the constraints.
+// Prereleases only match when a constraint mentions a prerelease.
+func matchVersion(cs []versionConstraint, tag string) bool {
+	v, ok := parseVersion(tag)
+	if !ok {
+		return false
+	}
+	if v.pre != "" {
+		allowed := false
+		for _, c := range cs {
+			if c.v.pre != "" && c.op != "<" {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, c := range cs {
+		if !c.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// tagSatisfies tells whether tag satisfies the given constraints.
+func tagSatisfies(constraints, tag string) bool {
+	cs, err := parseVersionConstraints(constraints)
+	return err == nil && matchVersion(cs, tag)
+}
+
+// resolveVersion returns the highest tag satisfying the constraints, or an
+// empty string if none does.
+func resolveVersion(constraints string, tags []string) (string, error) {
+	cs, err := parseVersionConstraints(constraints)
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	var bestVersion version
+	for _, tag := range tags {
+		if !matchVersion(cs, tag) {
+			continue
+		}
+		v, _ := parseVersion(tag)
+		if best == "" || v.compare(bestVersion) > 0 {
+			best, bestVersion = tag, v
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveVersion(t *testing.T) {
+	tags := []string{"v0.1.0", "v0.3.0", "v0.3.4", "v0.4.0", "v1.0.0", "v1.2.0", "v1.2.7", "v1.3.0-beta.1", "v1.3.0", "v2.0.0-rc.1", "v2.0.0", "latest"}
+	tests := []struct {
+		constraints string
+		expected    string
+	}{
+		{"~> 1.2", "v1.3.0"},
+		{"~> 1.2.0", "v1.2.7"},
+		{">= 1.0, < 2.0", "v1.3.0"},
+		{"^0.3", "v0.3.4"},
+		{"^1.0.0", "v1.3.0"},
+		{"~0.3.1", "v0.3.4"},
+		{">3.33", ""},
+		{"= 1.2", "v1.2.0"},
+		{"<= 1.2.7, != 1.2.7", "v1.2.0"},
+		{">= 2.0.0-rc.0", "v2.0.0"},
+		{"< 2.0.0-rc.2, >= 2.0.0-rc.0", "v2.0.0-rc.1"},
+	}
+	for _, test := range tests {
+		tag, err := resolveVersion(test.constraints, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag != test.expected {
+			t.Fatalf("%s: Expected %q, but %q:", test.constraints, test.expected, tag)
+		}
+	}
+
+	if _, err := resolveVersion("~> one", tags); err == nil {
+		t.Fatal("Expected an error for an invalid constraint")
+	}
+}
+
+func TestCheckoutVersionConstraint(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	origin := filepath.Join(dir, "origin")
+	gitRepo(t, origin)
+	for _, tag := range []string{"v1.0.0", "v1.2.0", "v2.0.0"} {
+		gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", tag)
+		gitCmd(t, origin, "tag", tag)
+	}
+	expected := gitCmd(t, origin, "rev-parse", "v1.2.0^{commit}")
+
+	p := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "clone", "-q", origin, p)
+
+	gom := Gom{name: "example.com/a", options: map[string]interface{}{"tag": "~> 1.0"}}
+	if err := gom.Checkout(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if rev := gitCmd(t, p, "rev-parse", "HEAD"); rev != expected {
+		t.Fatalf("Expected %s, but %s:", expected, rev)
+	}
+
+	// A newer matching tag doesn't change what the lock records for the
+	// installed commit.
+	gitCmd(t, p, "tag", "v1.3.0", "v2.0.0")
+	lw := &lockWriter{vendor: filepath.Join(dir, vendorFolder), previous: make(map[string]Gom)}
+	if _, err := lw.lockGom(&gom); err != nil {
+		t.Fatal(err)
+	}
+	if gom.options["tag"] != "v1.2.0" || gom.options["commit"] != expected {
+		t.Fatalf("Expected v1.2.0 at %s, but %v:", expected, gom.options)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// update moves the named packages, or all of them, to the newest revision
+// their Gomfile entry allows, rebuilds them and regenerates Gomfile.lock.
+// Packages following a branch or no pin at all move to its tip, packages
+// with a version constraint to the highest matching tag.
+func update(names []string) error {
+	allGoms, err := readGomfile("Gomfile")
+	if err != nil {
+		return err
+	}
+	goms := make([]Gom, 0)
+	for _, gom := range allGoms {
+		if goos, ok := gom.options["goos"]; ok {
+			if !matchOS(goos) {
+				continue
+			}
+		}
+		if len(names) > 0 && !has(names, gom.name) {
+			continue
+		}
+		goms = append(goms, gom)
+	}
+	for _, name := range names {
+		found := false
+		for _, gom := range goms {
+			found = found || gom.name == name
+		}
+		if !found {
+			return fmt.Errorf("%s is not in the Gomfile for this environment", name)
+		}
+	}
+
+	err = prepareVendor()
+	if err != nil {
+		return err
+	}
+	err = ready()
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	before := make(map[string]string)
+	if locked, err := readAllGoms("Gomfile.lock"); err == nil {
+		for _, gom := range locked {
+			if commit, ok := gom.options["commit"].(string); ok {
+				before[gom.name] = commit
+			}
+		}
+	}
+	for _, gom := range goms {
+		if _, ok := before[gom.name]; !ok {
+			before[gom.name] = installedRevision(vendor, gom.name)
+		}
+	}
+
+	err = forEachGom(goms, func(r *runner, gom *Gom) error {
+		defer lockRepository(gom)()
+		return gom.Update(r, vendor)
+	})
+	if err != nil {
+		return err
+	}
+	err = fetchImports(goms)
+	if err != nil {
+		return err
+	}
+	err = buildGoms(goms, []string{})
+	if err != nil {
+		return err
+	}
+	err = genGomfileLock()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(goms, func(i, j int) bool { return goms[i].name < goms[j].name })
+	for _, gom := range goms {
+		after := installedRevision(vendor, gom.name)
+		switch {
+		case has(gom.options, "commit"):
+			fmt.Printf("%s: pinned to %s in the Gomfile\n", gom.name, shortRevision(after))
+		case before[gom.name] == after:
+			fmt.Printf("%s: up to date at %s\n", gom.name, shortRevision(after))
+		default:
+			fmt.Printf("%s: %s -> %s\n", gom.name, shortRevision(before[gom.name]), shortRevision(after))
+		}
+	}
+	return nil
+}
+
+// Update fetches the repository of gom, cloning it if needed, and checks
+// out the newest revision allowed by its options.
+func (gom *Gom) Update(r *runner, vendor string) error {
+	p := filepath.Join(vendor, "src", gom.name)
+	vcs, root, err := getVcsCommand(vendor, p)
+	if !isDir(p) || err != nil {
+		err = gom.Clone(r)
+		if err != nil {
+			return err
+		}
+		vcs, root, err = getVcsCommand(vendor, p)
+		if err != nil {
+			return err
+		}
+	}
+	if has(gom.options, "commit") {
+		return gom.Checkout(r)
+	}
+
+	err = vcs.Fetch(r, root)
+	if err != nil {
+		return err
+	}
+	if has(gom.options, "tag") {
+		return gom.Checkout(r)
+	}
+	branch, _ := gom.options["branch"].(string)
+	return vcs.Checkout(r, root, vcs.Tip(branch))
+}
+
+// installedRevision returns the revision of the installed copy of a package,
+// or an empty string if it can't be found.
+func installedRevision(vendor, name string) string {
+	vcs, root, err := getVcsCommand(vendor, filepath.Join(vendor, "src", name))
+	if err != nil {
+		return ""
+	}
+	rev, err := vcs.Revision(root)
+	if err != nil {
+		return ""
+	}
+	return rev
+}
+
+func shortRevision(rev string) string {
+	if rev == "" {
+		return "(none)"
+	}
+	if len(rev) > 12 {
+		return rev[:12]
+	}
+	return rev
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGomUpdate(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	origin := filepath.Join(dir, "origin")
+	first := gitRepo(t, origin)
+	gitCmd(t, origin, "checkout", "-q", "-b", "feature")
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "feature")
+	gitCmd(t, origin, "checkout", "-q", "-")
+
+	vendor := filepath.Join(dir, vendorFolder)
+	for _, name := range []string{"a", "b", "c"} {
+		p := filepath.Join(vendor, "src", "example.com", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		gitCmd(t, dir, "clone", "-q", origin, p)
+	}
+
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "second")
+	tip := gitCmd(t, origin, "rev-parse", "HEAD")
+	gitCmd(t, origin, "checkout", "-q", "feature")
+	gitCmd(t, origin, "commit", "-q", "--allow-empty", "-m", "feature 2")
+	feature := gitCmd(t, origin, "rev-parse", "HEAD")
+
+	tests := []struct {
+		gom      Gom
+		expected string
+	}{
+		{Gom{name: "example.com/a", options: map[string]interface{}{}}, tip},
+		{Gom{name: "example.com/b", options: map[string]interface{}{"branch": "feature"}}, feature},
+		{Gom{name: "example.com/c", options: map[string]interface{}{"commit": first}}, first},
+	}
+	for _, test := range tests {
+		if err := test.gom.Update(directRunner(), vendor); err != nil {
+			t.Fatal(err)
+		}
+		if rev := installedRevision(vendor, test.gom.name); rev != test.expected {
+			t.Fatalf("%s: Expected %s, but %s:", test.gom.name, test.expected, rev)
+		}
+	}
+}
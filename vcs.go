@@ -0,0 +1,646 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VCS is a version control system packages can be installed with.
+type VCS interface {
+	// Name is how Gomfile.lock records the VCS.
+	Name() string
+	// Detect tells whether dir is the root of a checkout.
+	Detect(dir string) bool
+	// Clone checks out the repository at url, which may be a local mirror,
+	// in dest.
+	Clone(r *runner, url, dest string) error
+	// Fetch updates the repository in dir from its remote repository.
+	Fetch(r *runner, dir string) error
+	// Checkout moves the checkout in dir to rev, a revision, tag or branch.
+	Checkout(r *runner, dir, rev string) error
+	// Revision returns the revision the checkout in dir is at.
+	Revision(dir string) (string, error)
+	// Status returns the files of the checkout in dir that differ from its
+	// revision.
+	Status(dir string) ([]fileChange, error)
+	// RemoteURL returns the URL of the repository the checkout in dir was
+	// fetched from.
+	RemoteURL(dir string) (string, error)
+	// ListTags returns the names of the tags of the repository in dir.
+	ListTags(dir string) ([]string, error)
+	// Tip returns what to check out to follow branch, or the default branch
+	// if branch is empty, once the repository is fetched.
+	Tip(branch string) string
+}
+
+// remoteQuerier is a VCS which can ask the remote repository of a checkout
+// for the tip of a branch without fetching it.
+type remoteQuerier interface {
+	Latest(dir, branch string) (string, error)
+}
+
+// tagPointer is a VCS which can list the tags of a revision.
+type tagPointer interface {
+	TagsAt(dir, rev string) ([]string, error)
+}
+
+// differ is a VCS which can show the local changes of a checkout.
+type differ interface {
+	Diff(dir string, w io.Writer) error
+}
+
+// mirrorer is a VCS whose repositories can be mirrored in the cache.
+type mirrorer interface {
+	VCS
+	// CanMirror tells whether the VCS supports mirrors at all.
+	CanMirror() bool
+	// IsMirror tells whether dir is a mirror.
+	IsMirror(dir string) bool
+	// Mirror creates in dest a mirror of the repository at url, which may
+	// be a local checkout.
+	Mirror(r *runner, url, dest string) error
+	// PullFrom updates the checkout in dir from the mirror.
+	PullFrom(r *runner, dir, mirror string) error
+	// Contains tells whether the repository in dir knows revision rev.
+	Contains(dir, rev string) bool
+	// SetRemote makes url the remote repository of the copy in dir.
+	SetRemote(dir, url string) error
+	// Verify checks the integrity of the repository in dir.
+	Verify(dir string) error
+}
+
+// shallowFetcher is a VCS which can fetch a revision of a repository without
+// its history.
+type shallowFetcher interface {
+	// ShallowClone clones the repository at url in dest with as little
+	// history as its server allows to check out rev.
+	ShallowClone(r *runner, url, dest, rev string) error
+	// FetchShallow fetches rev in the shallow checkout in dir.
+	FetchShallow(r *runner, dir, rev string) error
+	// IsShallow tells whether the checkout in dir lacks history.
+	IsShallow(dir string) bool
+	// Contains tells whether the repository in dir knows revision rev.
+	Contains(dir, rev string) bool
+}
+
+// vcsList is the registry of the VCS gom knows, in the order they are
+// detected.
+var vcsList = []VCS{git, hg, bzr, svn, fossil}
+
+// registerVCS adds a VCS to the ones gom detects.
+func registerVCS(vcs VCS) {
+	vcsList = append(vcsList, vcs)
+}
+
+// vcsAt returns the VCS of the checkout whose root is dir, or nil.
+func vcsAt(dir string) VCS {
+	for _, vcs := range vcsList {
+		if vcs.Detect(dir) {
+			return vcs
+		}
+	}
+	return nil
+}
+
+// vcsByName returns the VCS named name, or nil.
+func vcsByName(name string) VCS {
+	for _, vcs := range vcsList {
+		if vcs.Name() == name {
+			return vcs
+		}
+	}
+	return nil
+}
+
+// mirrorerOf returns vcs if its repositories can be mirrored, or nil.
+func mirrorerOf(vcs VCS) mirrorer {
+	if m, ok := vcs.(mirrorer); ok && m.CanMirror() {
+		return m
+	}
+	return nil
+}
+
+// mirrorAt returns the VCS of the mirror in dir, or nil if there is none.
+func mirrorAt(dir string) mirrorer {
+	for _, vcs := range vcsList {
+		if m := mirrorerOf(vcs); m != nil && m.IsMirror(dir) {
+			return m
+		}
+	}
+	return nil
+}
+
+// isShallow tells whether the checkout of vcs in dir lacks history.
+func isShallow(vcs VCS, dir string) bool {
+	s, ok := vcs.(shallowFetcher)
+	return ok && s.IsShallow(dir)
+}
+
+// syncCheckout checks out rev in dir, fetching the repository first if rev
+// isn't known yet.
+func syncCheckout(r *runner, vcs VCS, dir, rev string) error {
+	if isShallow(vcs, dir) {
+		s := vcs.(shallowFetcher)
+		if !s.Contains(dir, rev) {
+			err := s.FetchShallow(r, dir, rev)
+			if err != nil {
+				return err
+			}
+		}
+		return vcs.Checkout(r, dir, rev)
+	}
+	err := vcs.Checkout(r, dir, rev)
+	if err != nil {
+		err = vcs.Fetch(r, dir)
+		if err != nil {
+			return err
+		}
+		err = vcs.Checkout(r, dir, rev)
+	}
+	return err
+}
+
+// vcsCmd is a VCS driven by its command line tool.
+type vcsCmd struct {
+	name string
+	// markers are the files of the root of a checkout, one is enough.
+	// mirrorMarkers are the files of a mirror, all are needed.
+	markers       []string
+	mirrorMarkers []string
+	checkout      []string
+	update        []string
+	revision      []string
+	revisionMask  string
+	remote        []string
+	tags          []string
+	// tagsAt lists the tags of revision %s.
+	tagsAt []string
+	// tip is the revision following the updated branch %s, defaultBranch
+	// the branch followed by packages without a pin.
+	tip           string
+	defaultBranch string
+	// latest queries the revision at the tip of branch %s on the remote
+	// repository, ref is how the branch is named in the query.
+	latest []string
+	ref    string
+	// status lists the files of a checkout that differ from its revision,
+	// one per line after a code containing one of untracked or deleted for
+	// such files. diff shows the changes of the tracked files.
+	status    []string
+	untracked []string
+	deleted   []string
+	diff      []string
+	// clone checks out a repository, mirror creates a mirror of it, pull
+	// updates a checkout from mirror %s and contains tells whether revision
+	// %s is known. setRemote points a copy to remote repository %s and
+	// verify checks the integrity of a repository.
+	clone     []string
+	mirror    []string
+	pull      []string
+	contains  []string
+	setRemote []string
+	verify    []string
+	// shallowClone clones the tip of the default branch without history,
+	// with shallowMarker in the checkout. fetchRevision and fetchTag fetch
+	// revision or tag %s alone, deepen fetches %s more commits of history
+	// and unshallow all of it.
+	shallowClone  []string
+	shallowMarker string
+	fetchRevision []string
+	fetchTag      []string
+	deepen        []string
+	unshallow     []string
+}
+
+// fileChange is a file of a checkout that differs from its revision.
+type fileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// Kinds of changes.
+const (
+	changeModified  = "modified"
+	changeUntracked = "untracked"
+	changeDeleted   = "deleted"
+)
+
+var (
+	hg = &vcsCmd{
+		name:          "hg",
+		markers:       []string{".hg"},
+		mirrorMarkers: []string{".hg"},
+		checkout:      []string{"hg", "update"},
+		update:        []string{"hg", "pull"},
+		revision:      []string{"hg", "id", "-i"},
+		revisionMask:  "^(.+)$",
+		remote:        []string{"hg", "paths", "default"},
+		tags:          []string{"hg", "tags", "-q"},
+		tagsAt:        []string{"hg", "log", "-r", "%s", "--template", "{tags}"},
+		tip:           "%s",
+		defaultBranch: "default",
+		latest:        []string{"hg", "identify", "-i", "-r", "%s", "default"},
+		ref:           "%s",
+		status:        []string{"hg", "status"},
+		untracked:     []string{"?"},
+		deleted:       []string{"R", "!"},
+		diff:          []string{"hg", "diff"},
+		clone:         []string{"hg", "clone", "-q"},
+		mirror:        []string{"hg", "clone", "-q", "-U"},
+		pull:          []string{"hg", "pull", "-q", "%s"},
+		contains:      []string{"hg", "log", "-q", "-r", "%s"},
+		verify:        []string{"hg", "verify", "-q"},
+	}
+	git = &vcsCmd{
+		name:          "git",
+		markers:       []string{".git"},
+		mirrorMarkers: []string{"HEAD", "objects"},
+		checkout:      []string{"git", "checkout", "-q"},
+		update:        []string{"git", "fetch"},
+		revision:      []string{"git", "rev-parse", "HEAD"},
+		revisionMask:  "^(.+)$",
+		remote:        []string{"git", "config", "--get", "remote.origin.url"},
+		tags:          []string{"git", "tag", "-l"},
+		tagsAt:        []string{"git", "tag", "--points-at", "%s"},
+		tip:           "origin/%s",
+		defaultBranch: "HEAD",
+		latest:        []string{"git", "ls-remote", "origin", "%s"},
+		ref:           "refs/heads/%s",
+		status:        []string{"git", "status", "--porcelain"},
+		untracked:     []string{"?"},
+		deleted:       []string{"D"},
+		diff:          []string{"git", "diff", "HEAD"},
+		clone:         []string{"git", "clone", "-q"},
+		mirror:        []string{"git", "clone", "-q", "--mirror"},
+		pull:          []string{"git", "fetch", "-q", "%s", "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+		contains:      []string{"git", "cat-file", "-e", "%s^{commit}"},
+		setRemote:     []string{"git", "remote", "set-url", "origin", "%s"},
+		verify:        []string{"git", "fsck", "--no-progress"},
+		shallowClone:  []string{"git", "clone", "-q", "--depth", "1", "--no-checkout"},
+		shallowMarker: filepath.Join(".git", "shallow"),
+		fetchRevision: []string{"git", "fetch", "-q", "--depth", "1", "origin", "%s"},
+		fetchTag:      []string{"git", "fetch", "-q", "--depth", "1", "origin", "tag", "%s"},
+		deepen:        []string{"git", "fetch", "-q", "--deepen", "%s", "origin"},
+		unshallow:     []string{"git", "fetch", "-q", "--unshallow", "origin", "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"},
+	}
+	bzr = &vcsCmd{
+		name:          "bzr",
+		markers:       []string{".bzr"},
+		mirrorMarkers: []string{".bzr"},
+		checkout:      []string{"bzr", "revert", "-r"},
+		update:        []string{"bzr", "pull"},
+		revision:      []string{"bzr", "log", "-r-1", "--line"},
+		revisionMask:  "^([0-9]+)",
+		remote:        []string{"bzr", "config", "parent_location"},
+		tags:          []string{"bzr", "tags"},
+		tip:           "-1",
+		latest:        []string{"bzr", "revno", ":parent"},
+		status:        []string{"bzr", "status", "--short"},
+		untracked:     []string{"?"},
+		deleted:       []string{"-", "D"},
+		diff:          []string{"bzr", "diff"},
+		clone:         []string{"bzr", "branch", "-q"},
+		mirror:        []string{"bzr", "branch", "-q", "--no-tree"},
+		pull:          []string{"bzr", "pull", "-q", "%s"},
+		contains:      []string{"bzr", "log", "-q", "-r", "%s"},
+		setRemote:     []string{"bzr", "config", "parent_location=%s"},
+		verify:        []string{"bzr", "check"},
+	}
+	svn = &vcsCmd{
+		name:         "svn",
+		markers:      []string{".svn"},
+		checkout:     []string{"svn", "update", "-q", "-r"},
+		update:       []string{"svn", "update", "-q"},
+		revision:     []string{"svn", "info", "--show-item", "revision"},
+		revisionMask: "^([0-9]+)",
+		remote:       []string{"svn", "info", "--show-item", "url"},
+		tip:          "HEAD",
+		latest:       []string{"svn", "info", "--show-item", "revision", "-r", "HEAD"},
+		status:       []string{"svn", "status"},
+		untracked:    []string{"?"},
+		deleted:      []string{"D", "!"},
+		diff:         []string{"svn", "diff"},
+		clone:        []string{"svn", "checkout", "-q"},
+	}
+	fossil = &vcsCmd{
+		name:          "fossil",
+		markers:       []string{".fslckout", "_FOSSIL_"},
+		checkout:      []string{"fossil", "update"},
+		update:        []string{"fossil", "pull"},
+		revision:      []string{"fossil", "info"},
+		revisionMask:  `(?m)^checkout:\s+([0-9a-f]+)`,
+		remote:        []string{"fossil", "remote-url"},
+		tags:          []string{"fossil", "tag", "list"},
+		tip:           "%s",
+		defaultBranch: "trunk",
+		status:        []string{"fossil", "changes", "--differ"},
+		untracked:     []string{"EXTRA"},
+		deleted:       []string{"DELETED", "MISSING"},
+		diff:          []string{"fossil", "diff"},
+	}
+)
+
+// expand replaces %s in args with value.
+func expand(args []string, value string) []string {
+	expanded := []string{}
+	for _, arg := range args {
+		if strings.Contains(arg, "%s") {
+			arg = fmt.Sprintf(arg, value)
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// vcsOutput runs args in dir and returns what they print.
+func vcsOutput(dir string, args []string) ([]byte, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	return cmd.Output()
+}
+
+func (vcs *vcsCmd) Name() string {
+	return vcs.name
+}
+
+func (vcs *vcsCmd) Detect(dir string) bool {
+	for _, marker := range vcs.markers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (vcs *vcsCmd) Clone(r *runner, url, dest string) error {
+	if vcs.clone == nil {
+		return fmt.Errorf("gom can't clone %s repositories", vcs.name)
+	}
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, vcs.clone...), url, dest)
+	return r.run("", None, args...)
+}
+
+func (vcs *vcsCmd) Fetch(r *runner, dir string) error {
+	return r.run(dir, None, vcs.update...)
+}
+
+func (vcs *vcsCmd) Checkout(r *runner, dir, rev string) error {
+	args := append(append([]string{}, vcs.checkout...), rev)
+	return r.run(dir, None, args...)
+}
+
+func (vcs *vcsCmd) Revision(dir string) (string, error) {
+	args := vcs.revision
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	b, err := cmd.Output()
+	if err != nil {
+		println(err.Error())
+		return "", err
+	}
+	rev := strings.TrimSpace(string(b))
+	if vcs.revisionMask != "" {
+		m := regexp.MustCompile(vcs.revisionMask).FindStringSubmatch(rev)
+		if len(m) < 2 {
+			return "", fmt.Errorf("no revision in the output of %s", strings.Join(args, " "))
+		}
+		return m[1], nil
+	}
+	return rev, nil
+}
+
+func (vcs *vcsCmd) RemoteURL(dir string) (string, error) {
+	b, err := vcsOutput(dir, vcs.remote)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (vcs *vcsCmd) ListTags(dir string) ([]string, error) {
+	if vcs.tags == nil {
+		return nil, fmt.Errorf("%s tags aren't supported", vcs.name)
+	}
+	b, err := vcsOutput(dir, vcs.tags)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			tags = append(tags, fields[0])
+		}
+	}
+	return tags, nil
+}
+
+func (vcs *vcsCmd) TagsAt(dir, rev string) ([]string, error) {
+	if vcs.tagsAt == nil {
+		return nil, fmt.Errorf("%s tags aren't supported", vcs.name)
+	}
+	b, err := vcsOutput(dir, expand(vcs.tagsAt, rev))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+func (vcs *vcsCmd) Tip(branch string) string {
+	if branch == "" {
+		branch = vcs.defaultBranch
+	}
+	if !strings.Contains(vcs.tip, "%s") {
+		return vcs.tip
+	}
+	return fmt.Sprintf(vcs.tip, branch)
+}
+
+// Latest asks the remote repository of the checkout in dir for the revision
+// at the tip of branch, or of the default branch if branch is empty.
+func (vcs *vcsCmd) Latest(dir, branch string) (string, error) {
+	if vcs.latest == nil {
+		return "", fmt.Errorf("%s can't query the remote repository", vcs.name)
+	}
+	ref := vcs.defaultBranch
+	if branch != "" && strings.Contains(vcs.ref, "%s") {
+		ref = fmt.Sprintf(vcs.ref, branch)
+	}
+	b, err := vcsOutput(dir, expand(vcs.latest, ref))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no branch %s in the remote repository", ref)
+	}
+	return fields[0], nil
+}
+
+func (vcs *vcsCmd) Status(dir string) ([]fileChange, error) {
+	b, err := vcsOutput(dir, vcs.status)
+	if err != nil {
+		return nil, err
+	}
+	changes := []fileChange{}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		code := strings.Fields(line)[0]
+		path := strings.TrimSpace(line[len(code):])
+		if i := strings.Index(path, " -> "); i >= 0 {
+			path = path[i+len(" -> "):]
+		}
+		kind := changeModified
+		switch {
+		case containsAny(code, vcs.untracked):
+			kind = changeUntracked
+		case containsAny(code, vcs.deleted):
+			kind = changeDeleted
+		}
+		changes = append(changes, fileChange{path, kind})
+	}
+	return changes, nil
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff writes the changes of the tracked files of the checkout in dir to w.
+func (vcs *vcsCmd) Diff(dir string, w io.Writer) error {
+	args := vcs.diff
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		// bzr exits with 1 when there are changes.
+		return nil
+	}
+	return err
+}
+
+func (vcs *vcsCmd) CanMirror() bool {
+	return vcs.mirror != nil
+}
+
+func (vcs *vcsCmd) IsMirror(dir string) bool {
+	for _, marker := range vcs.mirrorMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err != nil {
+			return false
+		}
+	}
+	return len(vcs.mirrorMarkers) > 0
+}
+
+func (vcs *vcsCmd) Mirror(r *runner, url, dest string) error {
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, vcs.mirror...), url, dest)
+	return r.run("", None, args...)
+}
+
+func (vcs *vcsCmd) PullFrom(r *runner, dir, mirror string) error {
+	return r.run(dir, None, expand(vcs.pull, mirror)...)
+}
+
+func (vcs *vcsCmd) Contains(dir, rev string) bool {
+	args := expand(vcs.contains, rev)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+func (vcs *vcsCmd) SetRemote(dir, url string) error {
+	if vcs.setRemote == nil {
+		// hg has no command for it.
+		hgrc := fmt.Sprintf("[paths]\ndefault = %s\n", url)
+		return ioutil.WriteFile(filepath.Join(dir, ".hg", "hgrc"), []byte(hgrc), 0644)
+	}
+	args := expand(vcs.setRemote, url)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	return cmd.Run()
+}
+
+func (vcs *vcsCmd) Verify(dir string) error {
+	args := vcs.verify
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// ShallowClone clones the tip of the repository without history, then
+// fetches rev alone if it isn't the tip. VCS without shallow clones clone
+// the whole repository.
+func (vcs *vcsCmd) ShallowClone(r *runner, url, dest, rev string) error {
+	if vcs.shallowClone == nil {
+		return vcs.Clone(r, url, dest)
+	}
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, vcs.shallowClone...), url, dest)
+	err = r.run("", None, args...)
+	if err != nil || vcs.Contains(dest, rev) {
+		return err
+	}
+	return vcs.FetchShallow(r, dest, rev)
+}
+
+// FetchShallow fetches rev as a revision, then as a tag. Servers which
+// refuse to serve a revision by itself get the history deepened until rev
+// shows up.
+func (vcs *vcsCmd) FetchShallow(r *runner, dir, rev string) error {
+	if vcs.fetchRevision == nil {
+		return vcs.Fetch(r, dir)
+	}
+	for _, args := range [][]string{vcs.fetchRevision, vcs.fetchTag} {
+		// Failing is expected, rev is either a revision or a tag.
+		_, err := vcsOutput(dir, expand(args, rev))
+		if err == nil && vcs.Contains(dir, rev) {
+			return nil
+		}
+	}
+	for depth := 16; depth <= 4096; depth *= 4 {
+		err := r.run(dir, None, expand(vcs.deepen, strconv.Itoa(depth))...)
+		if err != nil {
+			return err
+		}
+		if vcs.Contains(dir, rev) {
+			return nil
+		}
+	}
+	return r.run(dir, None, vcs.unshallow...)
+}
+
+func (vcs *vcsCmd) IsShallow(dir string) bool {
+	return vcs.shallowMarker != "" && isFile(filepath.Join(dir, vcs.shallowMarker))
+}
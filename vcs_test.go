@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// vcsRun runs a VCS command in dir and returns its trimmed output.
+func vcsRun(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, b)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func requireCommands(t *testing.T, names ...string) {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s is not installed", name)
+		}
+	}
+}
+
+// testBackend checks out rev1 of the checkout in wc, which is at rev2, and
+// checks that staleness checks and locking see it.
+func testBackend(t *testing.T, vcs VCS, vendor, wc, rev1, rev2 string) {
+	found, root, err := getVcsCommand(vendor, wc)
+	if err != nil || found != vcs || root != wc {
+		t.Fatalf("Expected %s at %s, but %v %v %v:", vcs.Name(), wc, found, root, err)
+	}
+	if rev, err := vcs.Revision(wc); err != nil || rev != rev2 {
+		t.Fatalf("Expected %v, but %v %v:", rev2, rev, err)
+	}
+
+	gom := Gom{name: "example.com/a", options: map[string]interface{}{"commit": rev1}}
+	if err := gom.Checkout(directRunner()); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := vcs.Revision(wc); err != nil || rev != rev1 {
+		t.Fatalf("Expected %v, but %v %v:", rev1, rev, err)
+	}
+	if report := checkReport(vendor, gom); report.Status != statusOK {
+		t.Fatalf("Expected %v, but %v %v:", statusOK, report.Status, report.Error)
+	}
+
+	lw := &lockWriter{vendor: vendor, previous: make(map[string]Gom)}
+	locked := Gom{name: gom.name, options: map[string]interface{}{}}
+	if _, err := lw.lockGom(&locked); err != nil {
+		t.Fatal(err)
+	}
+	if locked.options["commit"] != rev1 || locked.options["vcs"] != vcs.Name() {
+		t.Fatalf("Expected %s at %s to be locked, but %v:", vcs.Name(), rev1, locked.options)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(wc, "y.go"), []byte("package x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := vcs.Status(wc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != (fileChange{"y.go", changeUntracked}) {
+		t.Fatalf("Expected y.go to be untracked, but %v:", changes)
+	}
+}
+
+func TestSvnBackend(t *testing.T) {
+	requireCommands(t, "svn", "svnadmin")
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	vcsRun(t, dir, "svnadmin", "create", "repo")
+	wc := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	if err := os.MkdirAll(filepath.Dir(wc), 0755); err != nil {
+		t.Fatal(err)
+	}
+	vcsRun(t, dir, "svn", "checkout", "-q", "file://"+filepath.ToSlash(filepath.Join(dir, "repo")), wc)
+	for i, content := range []string{"package x\n", "package x // 2\n"} {
+		if err := ioutil.WriteFile(filepath.Join(wc, "x.go"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			vcsRun(t, wc, "svn", "add", "-q", "x.go")
+		}
+		vcsRun(t, wc, "svn", "commit", "-q", "-m", "commit")
+	}
+	vcsRun(t, wc, "svn", "update", "-q")
+
+	testBackend(t, svn, filepath.Join(dir, vendorFolder), wc, "1", "2")
+}
+
+func TestFossilBackend(t *testing.T) {
+	requireCommands(t, "fossil")
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	vcsRun(t, dir, "fossil", "init", "--admin-user", "gom", "repo.fossil")
+	wc := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	if err := os.MkdirAll(wc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	vcsRun(t, wc, "fossil", "open", filepath.Join(dir, "repo.fossil"))
+	revs := []string{}
+	for i, content := range []string{"package x\n", "package x // 2\n"} {
+		if err := ioutil.WriteFile(filepath.Join(wc, "x.go"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			vcsRun(t, wc, "fossil", "add", "x.go")
+		}
+		vcsRun(t, wc, "fossil", "commit", "--user", "gom", "--no-warnings", "-m", "commit")
+		rev, err := fossil.Revision(wc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+
+	testBackend(t, fossil, filepath.Join(dir, vendorFolder), wc, revs[0], revs[1])
+}
+
+func TestGitBackend(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+
+	wc := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	rev1 := gitRepo(t, wc)
+	gitCmd(t, wc, "commit", "-q", "--allow-empty", "-m", "second")
+	rev2 := gitCmd(t, wc, "rev-parse", "HEAD")
+
+	testBackend(t, git, filepath.Join(dir, vendorFolder), wc, rev1, rev2)
+}
+
+// fakeVCS is an in-memory VCS whose checkouts are the directories with a
+// .fake file. Checkouts track no file, every other file is untracked.
+type fakeVCS struct {
+	revisions map[string]string
+	known     []string
+}
+
+func (vcs *fakeVCS) Name() string { return "fake" }
+
+func (vcs *fakeVCS) Detect(dir string) bool { return isFile(filepath.Join(dir, ".fake")) }
+
+func (vcs *fakeVCS) Clone(r *runner, url, dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	vcs.revisions[dest] = vcs.known[len(vcs.known)-1]
+	return ioutil.WriteFile(filepath.Join(dest, ".fake"), []byte(url), 0644)
+}
+
+func (vcs *fakeVCS) Fetch(r *runner, dir string) error { return nil }
+
+func (vcs *fakeVCS) Checkout(r *runner, dir, rev string) error {
+	if !has(vcs.known, rev) {
+		return fmt.Errorf("unknown revision %s", rev)
+	}
+	vcs.revisions[dir] = rev
+	return nil
+}
+
+func (vcs *fakeVCS) Revision(dir string) (string, error) { return vcs.revisions[dir], nil }
+
+func (vcs *fakeVCS) Status(dir string) ([]fileChange, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	changes := []fileChange{}
+	for _, f := range files {
+		if f.Name() != ".fake" {
+			changes = append(changes, fileChange{f.Name(), changeUntracked})
+		}
+	}
+	return changes, nil
+}
+
+func (vcs *fakeVCS) RemoteURL(dir string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ".fake"))
+	return string(b), err
+}
+
+func (vcs *fakeVCS) ListTags(dir string) ([]string, error) { return nil, nil }
+
+func (vcs *fakeVCS) Tip(branch string) string { return vcs.known[len(vcs.known)-1] }
+
+func TestFakeBackend(t *testing.T) {
+	dir, cleanup := chdirTemp(t)
+	defer cleanup()
+	saved := vcsList
+	defer func() { vcsList = saved }()
+	fake := &fakeVCS{revisions: make(map[string]string), known: []string{"r1", "r2"}}
+	registerVCS(fake)
+
+	wc := filepath.Join(dir, vendorFolder, "src", "example.com", "a")
+	if err := fake.Clone(directRunner(), "https://example.com/a", wc); err != nil {
+		t.Fatal(err)
+	}
+	testBackend(t, fake, filepath.Join(dir, vendorFolder), wc, "r1", "r2")
+}